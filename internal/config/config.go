@@ -0,0 +1,553 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/itcaat/cli-stash/internal/shell"
+	"github.com/itcaat/cli-stash/internal/storage"
+)
+
+// Config is the cli-stash configuration
+type Config struct {
+	Storage Storage `toml:"storage"`
+	History History `toml:"history"`
+	UI      UI      `toml:"ui"`
+	Colors  Colors  `toml:"colors"`
+	Keys    Keys    `toml:"keys"`
+
+	// sources maps dotted keys like "history.limit" to where their value
+	// came from; keys missing from it have their default value
+	sources map[string]string
+}
+
+// Storage selects where commands are kept
+type Storage struct {
+	Backend string `toml:"backend"`
+	Stash   string `toml:"stash"`
+	DataDir string `toml:"data_dir"`
+}
+
+// History configures the shell history browser
+type History struct {
+	Limit        int      `toml:"limit"`
+	SkipPrefixes []string `toml:"skip_prefixes"`
+}
+
+// UI configures the interactive list
+type UI struct {
+	MaxShow int    `toml:"max_show"` // 0 fits the list to the terminal
+	Sort    string `toml:"sort"`
+	Theme   string `toml:"theme"`
+	Height  string `toml:"height"`  // lines or percent of the terminal, e.g. "40%"; empty for full screen
+	Reverse bool   `toml:"reverse"` // filter at the bottom
+
+	Preview         bool   `toml:"preview"`          // show the preview pane at start
+	PreviewPosition string `toml:"preview_position"` // auto, right or bottom
+
+	Editor string `toml:"editor"` // where Ctrl+E edits commands: builtin or external
+}
+
+// Editors for saved commands. External runs $VISUAL or $EDITOR.
+const (
+	EditorBuiltin  = "builtin"
+	EditorExternal = "external"
+)
+
+// Preview pane positions. Auto puts it on the right in wide terminals and
+// at the bottom otherwise.
+const (
+	PreviewAuto   = "auto"
+	PreviewRight  = "right"
+	PreviewBottom = "bottom"
+)
+
+// Themes are the names of the built-in themes
+var Themes = []string{ThemeAuto, ThemeDark, ThemeLight, ThemeHighContrast}
+
+// Built-in themes. The auto and high contrast themes adapt to the
+// terminal background.
+const (
+	ThemeAuto         = "auto"
+	ThemeDark         = "dark"
+	ThemeLight        = "light"
+	ThemeHighContrast = "high-contrast"
+)
+
+// Colors override single colours of the theme with ANSI numbers (0-255) or
+// hex (#rrggbb). An empty colour keeps the theme's, "none" uses the
+// terminal's default.
+type Colors struct {
+	Title    string `toml:"title"`
+	Normal   string `toml:"normal"`
+	Selected string `toml:"selected"`
+	Dim      string `toml:"dim"`
+	Match    string `toml:"match"`
+	Tag      string `toml:"tag"`
+	Origin   string `toml:"origin"`
+	Source   string `toml:"source"`
+	// Shell syntax highlighting of commands
+	Program  string `toml:"program"`
+	Flag     string `toml:"flag"`
+	String   string `toml:"string"`
+	Variable string `toml:"variable"`
+	Operator string `toml:"operator"`
+}
+
+// ColorNone is the colour value for the terminal's default colour
+const ColorNone = "none"
+
+// Keys binds the actions of each UI mode to key names as reported by
+// Bubble Tea, such as "ctrl+e", "up" or "j"
+type Keys struct {
+	List     ListKeys     `toml:"list"`
+	Normal   ListKeys     `toml:"normal"`
+	History  HistoryKeys  `toml:"history"`
+	Edit     EditKeys     `toml:"edit"`
+	Template TemplateKeys `toml:"template"`
+}
+
+// ListKeys are the actions on the saved commands. In the list mode typing
+// goes to the filter; the normal mode, entered with the mode key, leaves
+// plain letters like j and k free for actions.
+type ListKeys struct {
+	Up           []string `toml:"up"`
+	Down         []string `toml:"down"`
+	PageUp       []string `toml:"page_up"`
+	PageDown     []string `toml:"page_down"`
+	Home         []string `toml:"home"`
+	End          []string `toml:"end"`
+	ScrollLeft   []string `toml:"scroll_left"`
+	ScrollRight  []string `toml:"scroll_right"`
+	Select       []string `toml:"select"`
+	Cancel       []string `toml:"cancel"`
+	Add          []string `toml:"add"`
+	Edit         []string `toml:"edit"`
+	EditExternal []string `toml:"edit_external"` // straight to $VISUAL or $EDITOR
+	Delete       []string `toml:"delete"`
+	Sort         []string `toml:"sort"`
+	HereOnly     []string `toml:"here_only"`
+	Promote      []string `toml:"promote"`
+	SwitchStash  []string `toml:"switch_stash"`
+	Preview      []string `toml:"preview"`
+	Mode         []string `toml:"mode"`
+	Help         []string `toml:"help"`
+}
+
+// HistoryKeys are the actions while browsing shell history
+type HistoryKeys struct {
+	Up          []string `toml:"up"`
+	Down        []string `toml:"down"`
+	PageUp      []string `toml:"page_up"`
+	PageDown    []string `toml:"page_down"`
+	Home        []string `toml:"home"`
+	End         []string `toml:"end"`
+	ScrollLeft  []string `toml:"scroll_left"`
+	ScrollRight []string `toml:"scroll_right"`
+	Preview     []string `toml:"preview"`
+	Save        []string `toml:"save"`
+	Back        []string `toml:"back"`
+	Help        []string `toml:"help"`
+}
+
+// EditKeys are the actions of the edit form
+type EditKeys struct {
+	NextField []string `toml:"next_field"`
+	PrevField []string `toml:"prev_field"`
+	Save      []string `toml:"save"`
+	Newline   []string `toml:"newline"`  // line break in the command
+	External  []string `toml:"external"` // continue in $VISUAL or $EDITOR
+	Cancel    []string `toml:"cancel"`
+	Help      []string `toml:"help"`
+}
+
+// TemplateKeys are the actions while filling in placeholders
+type TemplateKeys struct {
+	Up        []string `toml:"up"`
+	Down      []string `toml:"down"`
+	Complete  []string `toml:"complete"`
+	RunSource []string `toml:"run_source"` // run a project command's suggestion command
+	Next      []string `toml:"next"`
+	Back      []string `toml:"back"`
+	Help      []string `toml:"help"`
+}
+
+// Source names for values that don't come from the config file
+const (
+	SourceDefault = "default"
+)
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		Storage: Storage{
+			Backend: storage.KindJSON,
+			Stash:   storage.DefaultStash,
+		},
+		History: History{
+			Limit:        500,
+			SkipPrefixes: append([]string(nil), shell.SkipPrefixes...),
+		},
+		UI: UI{
+			MaxShow: 0,
+			Sort:    string(storage.SortFrecency),
+			Theme:   ThemeAuto,
+
+			PreviewPosition: PreviewAuto,
+			Editor:          EditorBuiltin,
+		},
+		Keys: Keys{
+			List: ListKeys{
+				Up:           []string{"up", "ctrl+p"},
+				Down:         []string{"down", "ctrl+n"},
+				PageUp:       []string{"pgup"},
+				PageDown:     []string{"pgdown"},
+				Home:         []string{"home"},
+				End:          []string{"end"},
+				ScrollLeft:   []string{"shift+left"},
+				ScrollRight:  []string{"shift+right"},
+				Select:       []string{"enter"},
+				Cancel:       []string{"ctrl+c", "esc"},
+				Add:          []string{"ctrl+a"},
+				Edit:         []string{"ctrl+e"},
+				EditExternal: []string{"ctrl+x"},
+				Delete:       []string{"ctrl+d", "delete"},
+				Sort:         []string{"ctrl+s"},
+				HereOnly:     []string{"ctrl+l"},
+				Promote:      []string{"ctrl+y"},
+				SwitchStash:  []string{"tab"},
+				Preview:      []string{"ctrl+o"},
+				Mode:         []string{"ctrl+g"},
+				Help:         []string{"f1"},
+			},
+			Normal: ListKeys{
+				Up:           []string{"k", "up"},
+				Down:         []string{"j", "down"},
+				PageUp:       []string{"pgup", "ctrl+b"},
+				PageDown:     []string{"pgdown", "ctrl+f"},
+				Home:         []string{"g", "home"},
+				End:          []string{"G", "end"},
+				ScrollLeft:   []string{"left"},
+				ScrollRight:  []string{"right"},
+				Select:       []string{"enter"},
+				Cancel:       []string{"q", "esc", "ctrl+c"},
+				Add:          []string{"a"},
+				Edit:         []string{"e"},
+				EditExternal: []string{"E"},
+				Delete:       []string{"d"},
+				Sort:         []string{"s"},
+				HereOnly:     []string{"h"},
+				Promote:      []string{"y"},
+				SwitchStash:  []string{"tab"},
+				Preview:      []string{"p"},
+				Mode:         []string{"i", "/"},
+				Help:         []string{"?"},
+			},
+			History: HistoryKeys{
+				Up:          []string{"up", "ctrl+p"},
+				Down:        []string{"down", "ctrl+n"},
+				PageUp:      []string{"pgup"},
+				PageDown:    []string{"pgdown"},
+				Home:        []string{"home"},
+				End:         []string{"end"},
+				ScrollLeft:  []string{"shift+left"},
+				ScrollRight: []string{"shift+right"},
+				Preview:     []string{"ctrl+o"},
+				Save:        []string{"enter"},
+				Back:        []string{"esc", "ctrl+c"},
+				Help:        []string{"f1"},
+			},
+			Edit: EditKeys{
+				NextField: []string{"tab"},
+				PrevField: []string{"shift+tab"},
+				Save:      []string{"enter"},
+				Newline:   []string{"alt+enter", "ctrl+j"},
+				External:  []string{"ctrl+x"},
+				Cancel:    []string{"esc", "ctrl+c"},
+				Help:      []string{"f1"},
+			},
+			Template: TemplateKeys{
+				Up:        []string{"up", "ctrl+p"},
+				Down:      []string{"down", "ctrl+n"},
+				Complete:  []string{"tab"},
+				RunSource: []string{"ctrl+r"},
+				Next:      []string{"enter"},
+				Back:      []string{"esc", "ctrl+c"},
+				Help:      []string{"f1"},
+			},
+		},
+		sources: make(map[string]string),
+	}
+}
+
+// Path returns the config file location, config.toml in the XDG config directory
+func Path() (string, error) {
+	dir, err := storage.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// Load reads the config file at path over the defaults. A missing file is
+// not an error.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	md, err := toml.Decode(string(data), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("%s: unknown setting %q", path, undecoded[0].String())
+	}
+	for _, key := range md.Keys() {
+		cfg.sources[key.String()] = path
+	}
+	if cfg.Storage.DataDir, err = expandHome(cfg.Storage.DataDir); err != nil {
+		return nil, fmt.Errorf("%s: storage.data_dir: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// expandHome replaces a leading ~ in path with the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// Set overrides a string or boolean setting such as "storage.backend"
+// from another source, e.g. an environment variable or a flag. Empty
+// values are ignored.
+func (c *Config) Set(key, value, source string) {
+	if value == "" {
+		return
+	}
+	field, ok := c.field(key)
+	if !ok {
+		return
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return
+		}
+		field.SetBool(b)
+	default:
+		return
+	}
+	c.sources[key] = source
+}
+
+// ParseHeight parses a UI height: a number of lines like "20", a
+// percentage of the terminal like "40%", or "" for the full terminal
+func ParseHeight(s string) (height int, percent bool, err error) {
+	if s == "" {
+		return 0, false, nil
+	}
+	number, percent := strings.CutSuffix(s, "%")
+	height, err = strconv.Atoi(number)
+	if err != nil || height < 1 || percent && height > 100 {
+		return 0, false, fmt.Errorf("invalid height %q (want lines like 20 or a percentage like 40%%)", s)
+	}
+	return height, percent, nil
+}
+
+// Source returns where the setting key came from
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// field returns the struct field for a dotted key
+func (c *Config) field(key string) (reflect.Value, bool) {
+	i := strings.LastIndex(key, ".")
+	if i < 0 {
+		return reflect.Value{}, false
+	}
+	section, name := key[:i], key[i+1:]
+	for _, s := range c.settings() {
+		if s.section == section && s.name == name {
+			return s.value, true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setting is a single config value with its place in the file
+type setting struct {
+	section string // table name, e.g. "ui" or "keys.list"
+	name    string
+	value   reflect.Value
+}
+
+// settings lists every setting in file order
+func (c *Config) settings() []setting {
+	var settings []setting
+	var walk func(section string, v reflect.Value)
+	walk = func(section string, v reflect.Value) {
+		for i := 0; i < v.NumField(); i++ {
+			name := v.Type().Field(i).Tag.Get("toml")
+			if name == "" {
+				continue
+			}
+			if v.Field(i).Kind() == reflect.Struct {
+				walk(strings.TrimPrefix(section+"."+name, "."), v.Field(i))
+				continue
+			}
+			settings = append(settings, setting{section: section, name: name, value: v.Field(i)})
+		}
+	}
+	walk("", reflect.ValueOf(c).Elem())
+	return settings
+}
+
+// colorPattern matches ANSI colour numbers and hex colours
+var colorPattern = regexp.MustCompile(`^(\d{1,3}|#[0-9a-fA-F]{6}|#[0-9a-fA-F]{3})$`)
+
+// Validate checks every setting, reporting the first problem
+func (c *Config) Validate() error {
+	if c.Storage.Backend != storage.KindJSON && c.Storage.Backend != storage.KindBolt {
+		return fmt.Errorf("storage.backend: unknown backend %q (want %s or %s)", c.Storage.Backend, storage.KindJSON, storage.KindBolt)
+	}
+	if c.Storage.Stash != storage.DefaultStash && c.Storage.Stash != storage.AllStashes {
+		if err := storage.ValidateStashName(c.Storage.Stash); err != nil {
+			return fmt.Errorf("storage.stash: %w", err)
+		}
+	}
+	if dir := c.Storage.DataDir; dir != "" && !filepath.IsAbs(dir) {
+		return fmt.Errorf("storage.data_dir: %q is not an absolute path (start it with / or ~/)", dir)
+	}
+	if c.History.Limit < 1 || c.History.Limit > 100000 {
+		return fmt.Errorf("history.limit: must be between 1 and 100000, got %d", c.History.Limit)
+	}
+	for _, prefix := range c.History.SkipPrefixes {
+		if strings.TrimSpace(prefix) == "" {
+			return errors.New("history.skip_prefixes: prefixes can't be empty")
+		}
+	}
+	if c.UI.MaxShow < 0 || c.UI.MaxShow > 100 {
+		return fmt.Errorf("ui.max_show: must be between 0 (fit the terminal) and 100, got %d", c.UI.MaxShow)
+	}
+	if _, err := storage.ParseSortOrder(c.UI.Sort); err != nil {
+		return fmt.Errorf("ui.sort: %w", err)
+	}
+	if _, _, err := ParseHeight(c.UI.Height); err != nil {
+		return fmt.Errorf("ui.height: %w", err)
+	}
+	if p := c.UI.PreviewPosition; p != PreviewAuto && p != PreviewRight && p != PreviewBottom {
+		return fmt.Errorf("ui.preview_position: unknown position %q (want %s, %s or %s)", p, PreviewAuto, PreviewRight, PreviewBottom)
+	}
+	if e := c.UI.Editor; e != EditorBuiltin && e != EditorExternal {
+		return fmt.Errorf("ui.editor: unknown editor %q (want %s or %s)", e, EditorBuiltin, EditorExternal)
+	}
+	if !slices.Contains(Themes, c.UI.Theme) {
+		return fmt.Errorf("ui.theme: unknown theme %q (want one of %s)", c.UI.Theme, strings.Join(Themes, ", "))
+	}
+
+	// Keys may only be bound once per mode
+	bound := make(map[string]string)
+	for _, s := range c.settings() {
+		key := s.section + "." + s.name
+		switch {
+		case s.section == "colors":
+			color := s.value.String()
+			if color == "" || color == ColorNone {
+				continue
+			}
+			if !colorPattern.MatchString(color) {
+				return fmt.Errorf("%s: invalid colour %q (want an ANSI number 0-255, #rrggbb or %q)", key, color, ColorNone)
+			}
+			if n, err := strconv.Atoi(color); err == nil && n > 255 {
+				return fmt.Errorf("%s: ANSI colour %d is out of range 0-255", key, n)
+			}
+		case strings.HasPrefix(s.section, "keys."):
+			keys := s.value.Interface().([]string)
+			if len(keys) == 0 {
+				return fmt.Errorf("%s: at least one key is required", key)
+			}
+			for _, k := range keys {
+				if k == "" {
+					return fmt.Errorf("%s: key names can't be empty", key)
+				}
+				if other, ok := bound[s.section+" "+k]; ok {
+					return fmt.Errorf("%s: %q is already bound to %s", key, k, other)
+				}
+				bound[s.section+" "+k] = key
+			}
+		}
+	}
+	return nil
+}
+
+// Print writes the configuration as TOML, noting the source of each value
+func (c *Config) Print(w io.Writer) error {
+	section := ""
+	for _, s := range c.settings() {
+		if s.section != section {
+			if section != "" {
+				fmt.Fprintln(w)
+			}
+			section = s.section
+			fmt.Fprintf(w, "[%s]\n", section)
+		}
+		key := s.section + "." + s.name
+		if _, err := fmt.Fprintf(w, "%s = %s  # %s\n", s.name, formatValue(s.value), c.Source(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatValue renders a setting as a TOML value
+func formatValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestDefault(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Default().Validate() = %v, want nil", err)
+	}
+	if cfg.History.Limit != 500 {
+		t.Errorf("History.Limit = %d, want 500", cfg.History.Limit)
+	}
+	if cfg.UI.MaxShow != 0 {
+		t.Errorf("UI.MaxShow = %d, want 0", cfg.UI.MaxShow)
+	}
+	if got := cfg.Source("history.limit"); got != SourceDefault {
+		t.Errorf("Source() = %q, want %q", got, SourceDefault)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("MissingFile", func(t *testing.T) {
+		cfg, err := Load(filepath.Join(t.TempDir(), "config.toml"))
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if cfg.History.Limit != 500 {
+			t.Errorf("History.Limit = %d, want 500", cfg.History.Limit)
+		}
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		path := writeConfig(t, `
+[history]
+limit = 100
+
+[ui]
+sort = "alpha"
+
+[keys.list]
+up = ["k", "up"]
+down = ["j", "down"]
+`)
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if cfg.History.Limit != 100 {
+			t.Errorf("History.Limit = %d, want 100", cfg.History.Limit)
+		}
+		if cfg.UI.Sort != "alpha" {
+			t.Errorf("UI.Sort = %q, want alpha", cfg.UI.Sort)
+		}
+		if !slices.Equal(cfg.Keys.List.Down, []string{"j", "down"}) {
+			t.Errorf("Keys.List.Down = %v, want [j down]", cfg.Keys.List.Down)
+		}
+		// Unset values keep their defaults
+		if cfg.UI.MaxShow != 0 {
+			t.Errorf("UI.MaxShow = %d, want 0", cfg.UI.MaxShow)
+		}
+		if got := cfg.Source("history.limit"); got != path {
+			t.Errorf("Source(history.limit) = %q, want %q", got, path)
+		}
+		if got := cfg.Source("ui.max_show"); got != SourceDefault {
+			t.Errorf("Source(ui.max_show) = %q, want %q", got, SourceDefault)
+		}
+	})
+
+	t.Run("HomeDataDir", func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		cfg, err := Load(writeConfig(t, "[storage]\ndata_dir = \"~/stash\"\n"))
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if want := filepath.Join(home, "stash"); cfg.Storage.DataDir != want {
+			t.Errorf("Storage.DataDir = %q, want %q", cfg.Storage.DataDir, want)
+		}
+	})
+
+	errorTests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"UnknownSetting", "[ui]\nmax_shw = 3\n", `unknown setting "ui.max_shw"`},
+		{"WrongType", "[history]\nlimit = \"many\"\n", "history.limit"},
+		{"BadBackend", "[storage]\nbackend = \"sqlite\"\n", `storage.backend: unknown backend "sqlite"`},
+		{"RelativeDataDir", "[storage]\ndata_dir = \"stash\"\n", `storage.data_dir: "stash" is not an absolute path`},
+		{"BadStash", "[storage]\nstash = \"my stash\"\n", "storage.stash"},
+		{"LimitRange", "[history]\nlimit = 0\n", "history.limit: must be between 1 and 100000"},
+		{"MaxShowRange", "[ui]\nmax_show = 1000\n", "ui.max_show: must be between 0 (fit the terminal) and 100"},
+		{"BadSort", "[ui]\nsort = \"random\"\n", "ui.sort"},
+		{"BadHeight", "[ui]\nheight = \"40 %\"\n", `ui.height: invalid height "40 %"`},
+		{"HeightRange", "[ui]\nheight = \"150%\"\n", `ui.height: invalid height "150%"`},
+		{"BadPreview", "[ui]\npreview_position = \"left\"\n", `ui.preview_position: unknown position "left"`},
+		{"BadEditor", "[ui]\neditor = \"nano\"\n", `ui.editor: unknown editor "nano"`},
+		{"BadTheme", "[ui]\ntheme = \"solarized\"\n", `ui.theme: unknown theme "solarized"`},
+		{"BadColor", "[colors]\ntitle = \"pink\"\n", `colors.title: invalid colour "pink"`},
+		{"ColorRange", "[colors]\ntitle = \"300\"\n", "colors.title: ANSI colour 300 is out of range"},
+		{"NoKeys", "[keys.list]\nselect = []\n", "keys.list.select: at least one key is required"},
+		{"DuplicateKey", "[keys.list]\nedit = [\"ctrl+d\"]\n", `keys.list.delete: "ctrl+d" is already bound to keys.list.edit`},
+		{"OldKeys", "[keys]\nup = [\"k\"]\n", `unknown setting "keys.up"`},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, tt.content)
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Load() error = nil, want error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %q, want it to contain %q", err, tt.want)
+			}
+			if !strings.Contains(err.Error(), path) {
+				t.Errorf("Load() error = %q, want it to name the file", err)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	cfg := Default()
+	cfg.Set("storage.backend", "bolt", "flag --backend")
+	cfg.Set("storage.stash", "", "env CLI_STASH_NAME")
+	cfg.Set("storage.nothing", "x", "flag --nothing")
+	cfg.Set("ui.reverse", "true", "flag --reverse")
+	cfg.Set("ui.max_show", "5", "flag --max-show")
+
+	if cfg.Storage.Backend != "bolt" {
+		t.Errorf("Storage.Backend = %q, want bolt", cfg.Storage.Backend)
+	}
+	if got := cfg.Source("storage.backend"); got != "flag --backend" {
+		t.Errorf("Source(storage.backend) = %q, want flag --backend", got)
+	}
+	if !cfg.UI.Reverse || cfg.Source("ui.reverse") != "flag --reverse" {
+		t.Errorf("UI.Reverse = %v from %s, want true from flag --reverse", cfg.UI.Reverse, cfg.Source("ui.reverse"))
+	}
+	if cfg.UI.MaxShow != 0 || cfg.Source("ui.max_show") != SourceDefault {
+		t.Error("Set() should only change string and boolean settings")
+	}
+	if cfg.Storage.Stash != "default" || cfg.Source("storage.stash") != SourceDefault {
+		t.Errorf("empty value overrode storage.stash: %q from %s", cfg.Storage.Stash, cfg.Source("storage.stash"))
+	}
+}
+
+func TestParseHeight(t *testing.T) {
+	tests := []struct {
+		in          string
+		wantHeight  int
+		wantPercent bool
+		wantErr     bool
+	}{
+		{"", 0, false, false},
+		{"20", 20, false, false},
+		{"40%", 40, true, false},
+		{"100%", 100, true, false},
+		{"0", 0, false, true},
+		{"101%", 0, false, true},
+		{"half", 0, false, true},
+	}
+	for _, tt := range tests {
+		height, percent, err := ParseHeight(tt.in)
+		if (err != nil) != tt.wantErr || height != tt.wantHeight || percent != tt.wantPercent {
+			t.Errorf("ParseHeight(%q) = %d, %v, %v, want %d, %v, error %v", tt.in, height, percent, err, tt.wantHeight, tt.wantPercent, tt.wantErr)
+		}
+	}
+}
+
+func TestPrint(t *testing.T) {
+	path := writeConfig(t, "[ui]\nmax_show = 5\n")
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	cfg.Set("storage.backend", "bolt", "env CLI_STASH_BACKEND")
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"[storage]\n",
+		`backend = "bolt"  # env CLI_STASH_BACKEND`,
+		"max_show = 5  # " + path,
+		"limit = 500  # default",
+		"[keys.normal]\n",
+		`up = ["k", "up"]  # default`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Print() output missing %q:\n%s", want, out)
+		}
+	}
+
+	// The output is itself a valid config file
+	reloaded, err := Load(writeConfig(t, out))
+	if err != nil {
+		t.Fatalf("Load(Print()) error = %v", err)
+	}
+	if reloaded.UI.MaxShow != 5 || reloaded.Storage.Backend != "bolt" {
+		t.Errorf("Load(Print()) = %+v, want max_show 5 and bolt backend", reloaded)
+	}
+}
@@ -0,0 +1,248 @@
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scoring constants, modelled on fzf's algorithm
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	// Matches right after whitespace, delimiters or other non-word
+	// characters are likely the start of a word the user meant
+	bonusBoundary          = scoreMatch / 2
+	bonusBoundaryWhite     = bonusBoundary + 2
+	bonusBoundaryDelimiter = bonusBoundary + 1
+	bonusNonWord           = scoreMatch / 2
+
+	// camelCase and letter123 transitions are weaker boundaries
+	bonusCamel123 = bonusBoundary + scoreGapExtension
+
+	// A run of consecutive matches is worth at least this much per rune
+	bonusConsecutive = -(scoreGapStart + scoreGapExtension)
+
+	// The first pattern rune's bonus counts double
+	bonusFirstCharMultiplier = 2
+)
+
+// noScore marks a pattern rune that cannot be matched at a position
+const noScore = -1 << 30
+
+// charClass groups runes for boundary bonuses; word classes sort last
+type charClass int
+
+const (
+	classWhite charClass = iota
+	classNonWord
+	classDelimiter
+	classLower
+	classUpper
+	classLetter
+	classNumber
+)
+
+// delimiters separate path components, flags and key=value pairs
+const delimiters = "/,:;|-_.="
+
+// Result describes a successful match
+type Result struct {
+	Score     int
+	Positions []int // rune indexes of matched characters, ascending
+}
+
+func classOf(r rune) charClass {
+	switch {
+	case unicode.IsSpace(r):
+		return classWhite
+	case strings.ContainsRune(delimiters, r):
+		return classDelimiter
+	case unicode.IsLower(r):
+		return classLower
+	case unicode.IsUpper(r):
+		return classUpper
+	case unicode.IsLetter(r):
+		return classLetter
+	case unicode.IsDigit(r):
+		return classNumber
+	default:
+		return classNonWord
+	}
+}
+
+// bonusFor returns the bonus of matching a rune of class cur after prev
+func bonusFor(prev, cur charClass) int {
+	if cur > classNonWord {
+		switch prev {
+		case classWhite:
+			return bonusBoundaryWhite
+		case classDelimiter:
+			return bonusBoundaryDelimiter
+		case classNonWord:
+			return bonusBoundary
+		}
+	}
+	if prev == classLower && cur == classUpper || prev != classNumber && cur == classNumber {
+		return bonusCamel123
+	}
+	switch cur {
+	case classNonWord, classDelimiter:
+		return bonusNonWord
+	case classWhite:
+		return bonusBoundaryWhite
+	}
+	return 0
+}
+
+// Match reports whether pattern is a subsequence of text and scores the
+// best alignment: matches at word boundaries, after path separators and
+// in consecutive runs score higher, gaps cost points. Matching is case
+// insensitive unless pattern contains an upper-case letter.
+func Match(pattern, text string) (Result, bool) {
+	p := []rune(pattern)
+	t := []rune(text)
+	if len(p) == 0 {
+		return Result{}, true
+	}
+
+	folded := t
+	if !hasUpper(p) {
+		folded = make([]rune, len(t))
+		for i, r := range t {
+			folded[i] = unicode.ToLower(r)
+		}
+	}
+	if !isSubsequence(p, folded) {
+		return Result{}, false
+	}
+
+	n, m := len(t), len(p)
+	bonus := make([]int, n)
+	prev := classWhite
+	for j, r := range t {
+		class := classOf(r)
+		bonus[j] = bonusFor(prev, class)
+		prev = class
+	}
+
+	// score[i][j]: best score with p[i] matched at t[j]
+	// first[i][j]: bonus of the first rune of the run ending at (i, j)
+	// from[i][j]: where p[i-1] was matched on that best path
+	score := make([][]int, m)
+	first := make([][]int, m)
+	from := make([][]int, m)
+	for i := range p {
+		score[i] = make([]int, n)
+		first[i] = make([]int, n)
+		from[i] = make([]int, n)
+
+		// carry is the best score of p[i-1] matched two or more runes
+		// back, already charged for the gap up to j-1
+		carry, carryFrom := noScore, -1
+
+		for j := range t {
+			score[i][j] = noScore
+
+			if i > 0 && j >= 2 {
+				extended := carry + scoreGapExtension
+				if started := score[i-1][j-2] + scoreGapStart; score[i-1][j-2] != noScore && started >= extended {
+					carry, carryFrom = started, j-2
+				} else {
+					carry = extended
+				}
+			}
+
+			if folded[j] != p[i] {
+				continue
+			}
+
+			if i == 0 {
+				score[i][j] = scoreMatch + bonus[j]*bonusFirstCharMultiplier
+				first[i][j] = bonus[j]
+				from[i][j] = -1
+				continue
+			}
+
+			// Continue a consecutive run
+			if j > 0 && score[i-1][j-1] != noScore {
+				b := max(bonus[j], first[i-1][j-1], bonusConsecutive)
+				score[i][j] = score[i-1][j-1] + scoreMatch + b
+				first[i][j] = first[i-1][j-1]
+				from[i][j] = j - 1
+			}
+
+			// Or jump over a gap
+			if carry > noScore/2 {
+				if s := carry + scoreMatch + bonus[j]; s > score[i][j] {
+					score[i][j] = s
+					first[i][j] = bonus[j]
+					from[i][j] = carryFrom
+				}
+			}
+		}
+	}
+
+	best, end := noScore, -1
+	for j := range t {
+		if score[m-1][j] > best {
+			best, end = score[m-1][j], j
+		}
+	}
+	if end < 0 {
+		return Result{}, false
+	}
+
+	positions := make([]int, m)
+	for i, j := m-1, end; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+
+	return Result{Score: best, Positions: positions}, true
+}
+
+// MatchAll matches every whitespace-separated term of query against text,
+// like fzf's extended search. All terms must match; scores add up.
+func MatchAll(query, text string) (Result, bool) {
+	var total Result
+	seen := make(map[int]bool)
+
+	for _, term := range strings.Fields(query) {
+		r, ok := Match(term, text)
+		if !ok {
+			return Result{}, false
+		}
+		total.Score += r.Score
+		for _, pos := range r.Positions {
+			if !seen[pos] {
+				seen[pos] = true
+				total.Positions = append(total.Positions, pos)
+			}
+		}
+	}
+
+	sort.Ints(total.Positions)
+	return total, true
+}
+
+func hasUpper(runes []rune) bool {
+	for _, r := range runes {
+		if unicode.IsUpper(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSubsequence(pattern, text []rune) bool {
+	i := 0
+	for _, r := range text {
+		if i < len(pattern) && r == pattern[i] {
+			i++
+		}
+	}
+	return i == len(pattern)
+}
@@ -0,0 +1,84 @@
+package fuzzy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		text      string
+		ok        bool
+		positions []int
+	}{
+		{"", "anything", true, nil},
+		{"gst", "git status", true, []int{0, 4, 5}},
+		{"xyz", "git status", false, nil},
+		{"sg", "git status", false, nil},  // order matters
+		{"GIT", "git status", false, nil}, // smart case
+		{"Git", "Git status", true, []int{0, 1, 2}},
+		{"main", "git checkout main", true, []int{13, 14, 15, 16}},
+		// Prefer the word boundary over the first occurrence
+		{"co", "git commit && git checkout", true, []int{4, 5}},
+		{"force", "git push --force", true, []int{11, 12, 13, 14, 15}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.text, func(t *testing.T) {
+			r, ok := Match(tt.pattern, tt.text)
+			if ok != tt.ok {
+				t.Fatalf("Match(%q, %q) ok = %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(r.Positions, tt.positions) {
+				t.Errorf("Match(%q, %q) positions = %v, want %v", tt.pattern, tt.text, r.Positions, tt.positions)
+			}
+		})
+	}
+}
+
+func TestMatchRanking(t *testing.T) {
+	// Each pair: the first text should score higher than the second
+	tests := []struct {
+		pattern       string
+		better, worse string
+	}{
+		{"gs", "git status", "gists"},                     // boundaries
+		{"log", "kubectl logs", "kubectl get pods -o go"}, // consecutive run
+		{"dc", "docker compose up", "deploy.sh --clean"},
+		{"cfg", "~/.config/app.cfg", "cat config.go"},
+		{"ls", "ls -la", "kubectl delete svc"},
+		{"usr", "/usr/local/bin", "useradd root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			better, ok1 := Match(tt.pattern, tt.better)
+			worse, ok2 := Match(tt.pattern, tt.worse)
+			if !ok1 || !ok2 {
+				t.Fatalf("Match(%q) should match both %q and %q", tt.pattern, tt.better, tt.worse)
+			}
+			if better.Score <= worse.Score {
+				t.Errorf("Match(%q): %q scored %d, %q scored %d; want the first higher",
+					tt.pattern, tt.better, better.Score, tt.worse, worse.Score)
+			}
+		})
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	r, ok := MatchAll("gco mn", "git checkout main")
+	if !ok {
+		t.Fatal(`MatchAll("gco mn", "git checkout main") should match`)
+	}
+	if want := []int{0, 4, 9, 13, 16}; !reflect.DeepEqual(r.Positions, want) {
+		t.Errorf("MatchAll() positions = %v, want %v", r.Positions, want)
+	}
+
+	if _, ok := MatchAll("gco xyz", "git checkout main"); ok {
+		t.Error("MatchAll() should fail when any term fails")
+	}
+	if _, ok := MatchAll("   ", "anything"); !ok {
+		t.Error("MatchAll() with a blank query should match")
+	}
+}
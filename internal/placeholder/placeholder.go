@@ -0,0 +1,107 @@
+package placeholder
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholder is a value to fill in before a saved command is used.
+// It is written as <name> or {{name}}, optionally with a default
+// value: <name:default> or {{name:default}}, and a shell command whose
+// output lines are offered as suggestions: <pod|kubectl get pods -o name>.
+type Placeholder struct {
+	Name    string
+	Default string
+	Source  string
+}
+
+// placeholderRe matches both placeholder syntaxes. Names must start with a
+// letter or underscore, so shell redirections (< file, 2>&1, <<EOF) and Go
+// templates ({{.Field}}) are left alone. Sources in the {{...}} form may
+// contain < and > (e.g. 2>/dev/null) and braces (e.g. awk '{print $1}').
+var placeholderRe = regexp.MustCompile(
+	`<([A-Za-z_][A-Za-z0-9_-]*)(?::([^<>|]*))?(?:\|([^<>]*))?>` +
+		`|\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*(?::([^{}|]*))?(?:\|(.*?))?\s*\}\}`)
+
+// match describes one placeholder occurrence in a command
+type match struct {
+	start, end int
+	Placeholder
+}
+
+// find returns every placeholder occurrence in cmd
+func find(cmd string) []match {
+	var matches []match
+	for _, loc := range placeholderRe.FindAllStringSubmatchIndex(cmd, -1) {
+		m := match{start: loc[0], end: loc[1]}
+		group := func(i int) string {
+			if loc[2*i] < 0 {
+				return ""
+			}
+			return strings.TrimSpace(cmd[loc[2*i]:loc[2*i+1]])
+		}
+		if loc[2] >= 0 {
+			m.Name, m.Default, m.Source = group(1), group(2), group(3)
+		} else {
+			m.Name, m.Default, m.Source = group(4), group(5), group(6)
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// Parse returns the distinct placeholders in cmd in order of appearance.
+// When a name repeats, the first default and source given for it win.
+func Parse(cmd string) []Placeholder {
+	var result []Placeholder
+	index := make(map[string]int)
+	for _, m := range find(cmd) {
+		if i, ok := index[m.Name]; ok {
+			if result[i].Default == "" {
+				result[i].Default = m.Default
+			}
+			if result[i].Source == "" {
+				result[i].Source = m.Source
+			}
+			continue
+		}
+		index[m.Name] = len(result)
+		result = append(result, m.Placeholder)
+	}
+	return result
+}
+
+// Render substitutes values into cmd. Placeholders without a value use
+// their default; placeholders with neither are left as written.
+func Render(cmd string, values map[string]string) string {
+	defaults := make(map[string]string)
+	for _, p := range Parse(cmd) {
+		defaults[p.Name] = p.Default
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range find(cmd) {
+		b.WriteString(cmd[last:m.start])
+		if v, ok := values[m.Name]; ok {
+			b.WriteString(v)
+		} else if d := defaults[m.Name]; d != "" {
+			b.WriteString(d)
+		} else {
+			b.WriteString(cmd[m.start:m.end])
+		}
+		last = m.end
+	}
+	b.WriteString(cmd[last:])
+	return b.String()
+}
+
+// Spans returns the byte offsets of every placeholder occurrence in cmd
+// as [start, end) pairs, for highlighting
+func Spans(cmd string) [][2]int {
+	var spans [][2]int
+	for _, m := range find(cmd) {
+		spans = append(spans, [2]int{m.start, m.end})
+	}
+	return spans
+}
@@ -0,0 +1,73 @@
+package placeholder
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want []Placeholder
+	}{
+		{"ls -la", nil},
+		{"kubectl logs -n <namespace> <pod>", []Placeholder{{Name: "namespace"}, {Name: "pod"}}},
+		{"git checkout {{branch:main}}", []Placeholder{{Name: "branch", Default: "main"}}},
+		{"git push {{ remote : origin }} <branch:main>", []Placeholder{{Name: "remote", Default: "origin"}, {Name: "branch", Default: "main"}}},
+		{"echo <name> <name:bob>", []Placeholder{{Name: "name", Default: "bob"}}},
+		{"kubectl logs <pod|kubectl get pods -o name>", []Placeholder{{Name: "pod", Source: "kubectl get pods -o name"}}},
+		{"kubectl logs <pod:web|kubectl get pods | grep web>", []Placeholder{{Name: "pod", Default: "web", Source: "kubectl get pods | grep web"}}},
+		{"git checkout {{branch|git branch --format='%(refname:short)' 2>/dev/null}}", []Placeholder{{Name: "branch", Source: "git branch --format='%(refname:short)' 2>/dev/null"}}},
+		{"ssh {{host|awk '{print $1}' ~/.hosts}}", []Placeholder{{Name: "host", Source: "awk '{print $1}' ~/.hosts"}}},
+		// Shell syntax that must not be mistaken for placeholders
+		{"sort < in.txt > out.txt 2>&1", nil},
+		{"cat <<EOF > file", nil},
+		{"docker inspect -f '{{.State.Status}}' web", nil},
+		{"diff <(ls a) <(ls b)", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			got := Parse(tt.cmd)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		cmd    string
+		values map[string]string
+		want   string
+	}{
+		{"kubectl logs -n <namespace> <pod>", map[string]string{"namespace": "prod", "pod": "web-1"}, "kubectl logs -n prod web-1"},
+		{"git checkout {{branch:main}}", nil, "git checkout main"},
+		{"git checkout {{branch:main}}", map[string]string{"branch": "dev"}, "git checkout dev"},
+		{"echo <name> and <name>", map[string]string{"name": "x"}, "echo x and x"},
+		{"echo <missing>", nil, "echo <missing>"},
+		{"echo <empty>", map[string]string{"empty": ""}, "echo "},
+		{"kubectl logs <pod|kubectl get pods -o name> -f", map[string]string{"pod": "web"}, "kubectl logs web -f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			if got := Render(tt.cmd, tt.values); got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	cmd := "kubectl logs -n <namespace> {{pod}} 2>&1"
+	got := Spans(cmd)
+	want := [][2]int{{16, 27}, {28, 35}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Spans(%q) = %v, want %v", cmd, got, want)
+	}
+	if cmd[got[0][0]:got[0][1]] != "<namespace>" || cmd[got[1][0]:got[1][1]] != "{{pod}}" {
+		t.Errorf("Spans(%q) = %v, want the placeholders", cmd, got)
+	}
+}
@@ -0,0 +1,31 @@
+package shell
+
+import (
+	"os"
+	"os/exec"
+)
+
+// defaultEditor is used when neither $VISUAL nor $EDITOR is set
+const defaultEditor = "vi"
+
+// Editor returns the user's editor: $VISUAL, then $EDITOR, then vi.
+// It may include arguments, like "code --wait".
+func Editor() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); editor != "" {
+			return editor
+		}
+	}
+	return defaultEditor
+}
+
+// EditCommand returns a command opening path in the user's editor on the
+// terminal. /bin/sh splits the editor's arguments, so that whatever shell
+// the user runs, "code --wait" works as it would in their EDITOR.
+func EditCommand(path string) *exec.Cmd {
+	command := exec.Command("/bin/sh", "-c", Editor()+` "$1"`, "cli-stash", path)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	return command
+}
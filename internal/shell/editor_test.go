@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if got := Editor(); got != "vi" {
+		t.Errorf("Editor() = %q, want vi", got)
+	}
+
+	t.Setenv("EDITOR", "nano")
+	if got := Editor(); got != "nano" {
+		t.Errorf("Editor() = %q, want nano", got)
+	}
+
+	t.Setenv("VISUAL", "code --wait")
+	if got := Editor(); got != "code --wait" {
+		t.Errorf("Editor() = %q, want $VISUAL to win", got)
+	}
+}
+
+func TestEditCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my command.sh")
+	if err := os.WriteFile(path, []byte("ls\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// An "editor" with arguments that appends a line
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'echo "| wc -l" >> "$0"'`)
+	command := EditCommand(path)
+	command.Stdin, command.Stdout, command.Stderr = nil, nil, nil
+	if err := command.Run(); err != nil {
+		t.Fatalf("EditCommand().Run() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "ls\n| wc -l\n" {
+		t.Errorf("edited file = %q, want the appended line", got)
+	}
+}
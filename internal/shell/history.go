@@ -1,10 +1,14 @@
 package shell
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // GetLastCommand attempts to get the last command from shell history
@@ -249,9 +253,18 @@ func unescapeFishCommand(cmd string) string {
 	return cmd
 }
 
+// SkipPrefixes lists command prefixes left out of the history, so that
+// cli-stash's own invocations don't clutter it
+var SkipPrefixes = []string{"stash", "cli-stash"}
+
 // shouldSkipCommand returns true if command should be filtered out
 func shouldSkipCommand(cmd string) bool {
-	return strings.HasPrefix(cmd, "stash") || strings.HasPrefix(cmd, "cli-stash")
+	for _, prefix := range SkipPrefixes {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // getZshHistoryAll reads recent commands from ~/.zsh_history
@@ -469,3 +482,40 @@ func ExecuteCommand(cmd string) error {
 
 	return command.Run()
 }
+
+// CaptureOutput runs a command in a shell and returns its non-empty output
+// lines. The command is killed if it runs longer than timeout.
+func CaptureOutput(cmd string, timeout time.Duration) ([]string, error) {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, shell, "-c", cmd)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	// Don't wait for grandchildren that keep the output pipes open
+	command.WaitDelay = 500 * time.Millisecond
+
+	if err := command.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%q timed out after %s", cmd, timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
@@ -3,7 +3,9 @@ package shell
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetLastCommand(t *testing.T) {
@@ -123,3 +125,35 @@ pwd
 		}
 	})
 }
+
+func TestCaptureOutput(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	t.Run("Lines", func(t *testing.T) {
+		lines, err := CaptureOutput("printf 'pod/web-1\\n\\n  pod/api-2  \\n'", time.Second)
+		if err != nil {
+			t.Fatalf("CaptureOutput() error = %v", err)
+		}
+		if len(lines) != 2 || lines[0] != "pod/web-1" || lines[1] != "pod/api-2" {
+			t.Errorf("CaptureOutput() = %q, want [pod/web-1 pod/api-2]", lines)
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		_, err := CaptureOutput("echo boom >&2; exit 3", time.Second)
+		if err == nil || !strings.Contains(err.Error(), "boom") {
+			t.Errorf("CaptureOutput() error = %v, want stderr in error", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := CaptureOutput("sleep 5", 100*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("CaptureOutput() error = %v, want timeout", err)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Error("CaptureOutput() did not stop at the timeout")
+		}
+	})
+}
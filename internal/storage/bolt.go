@@ -0,0 +1,666 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names used by BoltStore
+var (
+	commandsBucket = []byte("commands") // id -> JSON encoded Command
+	textIndex      = []byte("idx_text") // sha256(text) -> id
+	tagIndex       = []byte("idx_tags") // tag \x00 id -> id
+	countIndex     = []byte("idx_count")  // countKey -> id, most used first
+	recentIndex    = []byte("idx_recent") // recentKey -> id, last used first
+	metaBucket     = []byte("meta")
+
+	// legacyUsageIndex ordered commands by use count until frecency, which
+	// depends on the current time, replaced it in schema 6
+	legacyUsageIndex = []byte("idx_usage")
+
+	importedKey  = []byte("imported_from")
+	schemaKey    = []byte("schema_version")
+	textIndexKey = []byte("text_index") // textIndexHashed once idx_text keys are hashes
+)
+
+// textIndexHashed marks a text index keyed by the sha256 of the text.
+// Older databases used the text itself, which fails for commands longer
+// than the 32KB bbolt allows in a key.
+const textIndexHashed = "sha256"
+
+// boltLegacySchema is the record format of databases created before the
+// schema version was recorded in the meta bucket
+const boltLegacySchema = 2
+
+// errNeedsMigration signals a read-only transaction found an old schema
+var errNeedsMigration = errors.New("database needs migration")
+
+// BoltStore is a Backend backed by an embedded bbolt database.
+// Commands are indexed by text, tag, use count and last use, so lookups
+// and IncrementUse touch only a single record, and listing by count or
+// recency reads the commands in index order. Frecency depends on the
+// current time, so it is computed when listing.
+type BoltStore struct {
+	path string
+}
+
+// NewBolt creates a BoltStore using the database file at path
+func NewBolt(path string) *BoltStore {
+	return &BoltStore{path: path}
+}
+
+// open opens the database for a single operation. The file is not kept
+// open between calls so several cli-stash processes can share it.
+func (s *BoltStore) open(readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(s.path, 0644, &bolt.Options{
+		Timeout:  time.Second,
+		ReadOnly: readOnly,
+	})
+}
+
+// view runs fn in a read-only transaction. fn receives a nil transaction
+// if the database doesn't exist yet.
+func (s *BoltStore) view(fn func(tx *bolt.Tx) error) error {
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		return fn(nil)
+	}
+
+	err := s.viewOnce(fn)
+	if errors.Is(err, errNeedsMigration) {
+		// Upgrade with a write transaction, then retry
+		if err := s.update(func(*bolt.Tx) error { return nil }); err != nil {
+			return err
+		}
+		err = s.viewOnce(fn)
+	}
+	return err
+}
+
+func (s *BoltStore) viewOnce(fn func(tx *bolt.Tx) error) error {
+	db, err := s.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(commandsBucket) == nil {
+			return fn(nil)
+		}
+		if schemaVersion(tx) < SchemaVersion || tx.Bucket(countIndex) == nil {
+			return errNeedsMigration
+		}
+		return fn(tx)
+	})
+}
+
+// update runs fn in a read-write transaction, creating buckets and
+// migrating old records as needed
+func (s *BoltStore) update(fn func(tx *bolt.Tx) error) error {
+	db, err := s.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		fresh := tx.Bucket(commandsBucket) == nil
+		indexed := tx.Bucket(countIndex) != nil
+		for _, name := range [][]byte{commandsBucket, textIndex, tagIndex, countIndex, recentIndex, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if fresh {
+			if err := setSchemaVersion(tx); err != nil {
+				return err
+			}
+		}
+		if err := migrateBolt(tx, s.path); err != nil {
+			return err
+		}
+		if err := hashTextIndex(tx); err != nil {
+			return err
+		}
+		if !indexed {
+			// Databases from before the usage indexes
+			commands, err := allCommands(tx)
+			if err != nil {
+				return err
+			}
+			if err := replaceAll(tx, commands); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+// Load reads all commands from storage
+func (s *BoltStore) Load() ([]Command, error) {
+	commands := []Command{}
+	err := s.view(func(tx *bolt.Tx) error {
+		if tx == nil {
+			return nil
+		}
+		var err error
+		commands, err = allCommands(tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+// List returns all commands sorted by frecency (most relevant first),
+// boosting those used in the current directory or repository
+func (s *BoltStore) List() ([]Command, error) {
+	commands, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	Sort(commands, SortFrecency, CurrentPlace())
+	return commands, nil
+}
+
+// Add appends a new command to storage
+func (s *BoltStore) Add(text string) (Command, error) {
+	var added Command
+	err := s.update(func(tx *bolt.Tx) error {
+		if cmd, err := findText(tx, text); !errors.Is(err, ErrNotFound) {
+			// Already exists, skip
+			added = cmd
+			return err
+		}
+
+		b := tx.Bucket(commandsBucket)
+		id := randomID()
+		for b.Get([]byte(id)) != nil {
+			id = randomID()
+		}
+
+		added = Command{
+			ID:        id,
+			Text:      text,
+			CreatedAt: time.Now(),
+			UseCount:  0,
+		}
+		return putCommand(tx, added)
+	})
+	return added, err
+}
+
+// Upsert saves cmd like Save, touching only its own record
+func (s *BoltStore) Upsert(cmd Command) (Command, bool, error) {
+	var saved Command
+	isNew := false
+	err := s.update(func(tx *bolt.Tx) error {
+		existing, err := findText(tx, cmd.Text)
+		if errors.Is(err, ErrNotFound) {
+			isNew = true
+			b := tx.Bucket(commandsBucket)
+			id := randomID()
+			for b.Get([]byte(id)) != nil {
+				id = randomID()
+			}
+			saved = newSaved(cmd, id)
+			return putCommand(tx, saved)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := deleteCommand(tx, existing); err != nil {
+			return err
+		}
+		mergeSaved(&existing, cmd)
+		saved = existing
+		return putCommand(tx, saved)
+	})
+	if err != nil {
+		return Command{}, false, err
+	}
+	return saved, isNew, nil
+}
+
+// Remove deletes a command from storage
+func (s *BoltStore) Remove(id string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		cmd, err := getCommand(tx, []byte(id))
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return deleteCommand(tx, cmd)
+	})
+}
+
+// Update replaces the command text, tags and description, preserving
+// metadata. It fails with ErrDuplicate if another command has the text.
+func (s *BoltStore) Update(updated Command) error {
+	return s.modify(updated.ID, func(cmd *Command) {
+		cmd.Text = updated.Text
+		cmd.Tags = NormalizeTags(updated.Tags)
+		cmd.Description = strings.TrimSpace(updated.Description)
+	})
+}
+
+// ListSorted returns all commands in the given order. The count and
+// recent orders are read from their index; the others are sorted in
+// memory like List.
+func (s *BoltStore) ListSorted(order SortOrder, place Place) ([]Command, error) {
+	var index []byte
+	switch order {
+	case SortCount:
+		index = countIndex
+	case SortRecent:
+		index = recentIndex
+	default:
+		commands, err := s.Load()
+		if err != nil {
+			return nil, err
+		}
+		Sort(commands, order, place)
+		return commands, nil
+	}
+
+	commands := []Command{}
+	err := s.view(func(tx *bolt.Tx) error {
+		if tx == nil {
+			return nil
+		}
+		return tx.Bucket(index).ForEach(func(_, id []byte) error {
+			cmd, err := getCommand(tx, id)
+			if err != nil {
+				return err
+			}
+			commands = append(commands, cmd)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+// ByTag returns the commands carrying tag using the tag index
+func (s *BoltStore) ByTag(tag string) ([]Command, error) {
+	commands := []Command{}
+	normalized := NormalizeTags([]string{tag})
+	if len(normalized) == 0 {
+		return commands, nil
+	}
+	prefix := append([]byte(normalized[0]), 0)
+	err := s.view(func(tx *bolt.Tx) error {
+		if tx == nil {
+			return nil
+		}
+		c := tx.Bucket(tagIndex).Cursor()
+		for k, id := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, id = c.Next() {
+			cmd, err := getCommand(tx, id)
+			if err != nil {
+				return err
+			}
+			commands = append(commands, cmd)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	Sort(commands, SortFrecency, CurrentPlace())
+	return commands, nil
+}
+
+// IncrementUse records a use of a command at place
+func (s *BoltStore) IncrementUse(id string, place Place) error {
+	now := time.Now()
+	return s.modify(id, func(cmd *Command) {
+		recordUse(cmd, now, place)
+	})
+}
+
+// modify applies fn to a single command, keeping its index entries in sync.
+// It fails with ErrDuplicate if fn gives the command the text of another.
+func (s *BoltStore) modify(id string, fn func(cmd *Command)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		cmd, err := getCommand(tx, []byte(id))
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := deleteCommand(tx, cmd); err != nil {
+			return err
+		}
+		fn(&cmd)
+		owner, err := findText(tx, cmd.Text)
+		if err == nil && owner.ID != cmd.ID {
+			return duplicateError(owner.ID)
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return putCommand(tx, cmd)
+	})
+}
+
+// Transaction loads all commands, passes them to fn and replaces the
+// stored commands with the result in a single database transaction
+func (s *BoltStore) Transaction(fn func(commands []Command) ([]Command, error)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		commands, err := allCommands(tx)
+		if err != nil {
+			return err
+		}
+
+		commands, err = fn(commands)
+		if err != nil {
+			return err
+		}
+
+		return replaceAll(tx, commands)
+	})
+}
+
+// ImportJSON copies the commands of a legacy commands.json file into the
+// database. The import runs only once per database, so commands deleted
+// afterwards are not brought back. Once it has run, the JSON file is not
+// read again.
+func (s *BoltStore) ImportJSON(jsonPath string) error {
+	if _, err := os.Stat(jsonPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	imported := false
+	err := s.view(func(tx *bolt.Tx) error {
+		imported = tx != nil && tx.Bucket(metaBucket).Get(importedKey) != nil
+		return nil
+	})
+	if err != nil || imported {
+		return err
+	}
+
+	commands, err := jsonView(jsonPath).Load()
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		if meta.Get(importedKey) != nil {
+			return nil
+		}
+		for _, cmd := range commands {
+			if _, err := findText(tx, cmd.Text); !errors.Is(err, ErrNotFound) {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err := putCommand(tx, cmd); err != nil {
+				return err
+			}
+		}
+		return meta.Put(importedKey, []byte(jsonPath))
+	})
+}
+
+// schemaVersion returns the record schema recorded in the meta bucket
+func schemaVersion(tx *bolt.Tx) int {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return boltLegacySchema
+	}
+	v, err := strconv.Atoi(string(meta.Get(schemaKey)))
+	if err != nil {
+		return boltLegacySchema
+	}
+	return v
+}
+
+// setSchemaVersion records that all records use the current schema
+func setSchemaVersion(tx *bolt.Tx) error {
+	return tx.Bucket(metaBucket).Put(schemaKey, []byte(strconv.Itoa(SchemaVersion)))
+}
+
+// migrateBolt upgrades records written with an older schema using the
+// same migrations as commands.json, and refuses to touch newer databases
+func migrateBolt(tx *bolt.Tx, path string) error {
+	version := schemaVersion(tx)
+	if version > SchemaVersion {
+		return &SchemaError{Path: path, Version: version}
+	}
+	if version == SchemaVersion {
+		return nil
+	}
+
+	doc := document{Version: version}
+	err := tx.Bucket(commandsBucket).ForEach(func(_, v []byte) error {
+		var record map[string]any
+		if err := json.Unmarshal(v, &record); err != nil {
+			return err
+		}
+		doc.Commands = append(doc.Commands, record)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := doc.upgrade(); err != nil {
+		return err
+	}
+	commands, err := doc.commands()
+	if err != nil {
+		return err
+	}
+	if err := replaceAll(tx, commands); err != nil {
+		return err
+	}
+	if err := tx.DeleteBucket(legacyUsageIndex); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	return setSchemaVersion(tx)
+}
+
+// allCommands decodes every stored command
+func allCommands(tx *bolt.Tx) ([]Command, error) {
+	commands := []Command{}
+	err := tx.Bucket(commandsBucket).ForEach(func(_, v []byte) error {
+		var cmd Command
+		if err := json.Unmarshal(v, &cmd); err != nil {
+			return err
+		}
+		commands = append(commands, cmd)
+		return nil
+	})
+	return commands, err
+}
+
+// getCommand decodes the command stored under id
+func getCommand(tx *bolt.Tx, id []byte) (Command, error) {
+	var cmd Command
+	data := tx.Bucket(commandsBucket).Get(id)
+	if data == nil {
+		return cmd, ErrNotFound
+	}
+	err := json.Unmarshal(data, &cmd)
+	return cmd, err
+}
+
+// putCommand stores cmd and its index entries
+func putCommand(tx *bolt.Tx, cmd Command) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+
+	id := []byte(cmd.ID)
+	if err := tx.Bucket(commandsBucket).Put(id, data); err != nil {
+		return err
+	}
+	if err := tx.Bucket(textIndex).Put(textKey(cmd.Text), id); err != nil {
+		return err
+	}
+	for _, tag := range cmd.Tags {
+		if err := tx.Bucket(tagIndex).Put(tagKey(tag, cmd.ID), id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(countIndex).Put(countKey(cmd), id); err != nil {
+		return err
+	}
+	return tx.Bucket(recentIndex).Put(recentKey(cmd), id)
+}
+
+// deleteCommand removes cmd and its index entries
+func deleteCommand(tx *bolt.Tx, cmd Command) error {
+	texts := tx.Bucket(textIndex)
+	if owner := texts.Get(textKey(cmd.Text)); string(owner) == cmd.ID {
+		if err := texts.Delete(textKey(cmd.Text)); err != nil {
+			return err
+		}
+	}
+	for _, tag := range cmd.Tags {
+		if err := tx.Bucket(tagIndex).Delete(tagKey(tag, cmd.ID)); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(countIndex).Delete(countKey(cmd)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(recentIndex).Delete(recentKey(cmd)); err != nil {
+		return err
+	}
+	return tx.Bucket(commandsBucket).Delete([]byte(cmd.ID))
+}
+
+// replaceAll drops every command and index entry and stores commands instead
+func replaceAll(tx *bolt.Tx, commands []Command) error {
+	for _, name := range [][]byte{commandsBucket, textIndex, tagIndex, countIndex, recentIndex} {
+		if err := tx.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	for _, cmd := range commands {
+		if _, err := findText(tx, cmd.Text); !errors.Is(err, ErrNotFound) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if cmd.ID == "" {
+			cmd.ID = randomID()
+		}
+		if err := putCommand(tx, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textKey builds a text index key. Hashing keeps long commands within the
+// bbolt key size limit.
+func textKey(text string) []byte {
+	sum := sha256.Sum256([]byte(text))
+	return sum[:]
+}
+
+// findText returns the command saved with text, or ErrNotFound
+func findText(tx *bolt.Tx, text string) (Command, error) {
+	id := tx.Bucket(textIndex).Get(textKey(text))
+	if id == nil {
+		return Command{}, ErrNotFound
+	}
+	cmd, err := getCommand(tx, id)
+	if err == nil && cmd.Text != text {
+		return Command{}, ErrNotFound
+	}
+	return cmd, err
+}
+
+// hashTextIndex rebuilds a text index keyed by the text itself, as written
+// by older versions, with hashed keys
+func hashTextIndex(tx *bolt.Tx) error {
+	meta := tx.Bucket(metaBucket)
+	if string(meta.Get(textIndexKey)) == textIndexHashed {
+		return nil
+	}
+
+	commands, err := allCommands(tx)
+	if err != nil {
+		return err
+	}
+	if err := tx.DeleteBucket(textIndex); err != nil {
+		return err
+	}
+	texts, err := tx.CreateBucket(textIndex)
+	if err != nil {
+		return err
+	}
+	for _, cmd := range commands {
+		key := textKey(cmd.Text)
+		if texts.Get(key) != nil {
+			continue
+		}
+		if err := texts.Put(key, []byte(cmd.ID)); err != nil {
+			return err
+		}
+	}
+	return meta.Put(textIndexKey, []byte(textIndexHashed))
+}
+
+// tagKey builds a tag index key; all entries of a tag share a prefix
+func tagKey(tag, id string) []byte {
+	return []byte(tag + "\x00" + id)
+}
+
+// countKey builds a use count index key. Keys sort by use count, then by
+// creation time, both descending like SortCount.
+func countKey(cmd Command) []byte {
+	return usageKey(uint64(max(cmd.UseCount, 0)), cmd)
+}
+
+// recentKey builds a last use index key. Keys sort by last use, then by
+// creation time, both descending like SortRecent; unused commands come last.
+func recentKey(cmd Command) []byte {
+	return usageKey(unixNano(cmd.LastUsedAt), cmd)
+}
+
+// usageKey builds an index key sorting by value, then creation time, both
+// descending, made unique by the command ID
+func usageKey(value uint64, cmd Command) []byte {
+	key := make([]byte, 16, 16+len(cmd.ID))
+	binary.BigEndian.PutUint64(key, math.MaxUint64-value)
+	binary.BigEndian.PutUint64(key[8:], math.MaxUint64-unixNano(cmd.CreatedAt))
+	return append(key, cmd.ID...)
+}
+
+// unixNano returns t in nanoseconds since 1970, or 0 for earlier times
+// and the zero time
+func unixNano(t time.Time) uint64 {
+	if t.Before(time.Unix(0, 0)) {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
@@ -0,0 +1,364 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStoreOperations(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "stash-bolt-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	store := NewBolt(filepath.Join(tmpDir, "commands.db"))
+
+	t.Run("LoadEmpty", func(t *testing.T) {
+		commands, err := store.Load()
+		if err != nil {
+			t.Errorf("Load() error = %v", err)
+		}
+		if len(commands) != 0 {
+			t.Errorf("Load() = %v, want empty slice", commands)
+		}
+	})
+
+	ids := make(map[string]string)
+	t.Run("AddAndDuplicate", func(t *testing.T) {
+		for _, text := range []string{"echo hello", "ls -la", "echo hello"} {
+			cmd, err := store.Add(text)
+			if err != nil {
+				t.Fatalf("Add(%q) error = %v", text, err)
+			}
+			if prev, ok := ids[text]; ok && prev != cmd.ID {
+				t.Errorf("Add(%q) duplicate ID = %q, want %q", text, cmd.ID, prev)
+			}
+			ids[text] = cmd.ID
+		}
+
+		commands, err := store.Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(commands) != 2 {
+			t.Errorf("Load() len = %d, want 2", len(commands))
+		}
+	})
+
+	t.Run("IncrementUseReorders", func(t *testing.T) {
+		if err := store.IncrementUse(ids["echo hello"], Place{}); err != nil {
+			t.Fatalf("IncrementUse() error = %v", err)
+		}
+
+		commands, err := store.List()
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(commands) != 2 || commands[0].Text != "echo hello" {
+			t.Errorf("List() = %v, want echo hello first", commands)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		err := store.Update(Command{ID: ids["echo hello"], Text: "echo world", Tags: []string{"#Demo"}})
+		if err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+
+		cmd, err := Resolve(store, ids["echo hello"])
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if cmd.Text != "echo world" || cmd.UseCount != 1 {
+			t.Errorf("Update() = %+v, want new text with metadata preserved", cmd)
+		}
+	})
+
+	t.Run("ByTag", func(t *testing.T) {
+		commands, err := ByTag(store, "demo")
+		if err != nil {
+			t.Fatalf("ByTag() error = %v", err)
+		}
+		if len(commands) != 1 || commands[0].Text != "echo world" {
+			t.Errorf("ByTag(demo) = %v, want [echo world]", commands)
+		}
+
+		// Retagging must drop the stale index entry
+		store.Update(Command{ID: ids["echo hello"], Text: "echo world", Tags: []string{"other"}})
+		commands, _ = ByTag(store, "demo")
+		if len(commands) != 0 {
+			t.Errorf("ByTag(demo) after retag = %v, want none", commands)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		if err := store.Remove(ids["echo hello"]); err != nil {
+			t.Fatalf("Remove() error = %v", err)
+		}
+
+		commands, _ := store.List()
+		if len(commands) != 1 || commands[0].Text != "ls -la" {
+			t.Errorf("List() = %v, want [ls -la]", commands)
+		}
+	})
+}
+
+func TestBoltUpdateDuplicate(t *testing.T) {
+	store := NewBolt(filepath.Join(t.TempDir(), "commands.db"))
+	a, _ := store.Add("a")
+	x, _ := store.Add("X")
+
+	err := store.Update(Command{ID: a.ID, Text: "X"})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("Update() to the text of %s error = %v, want ErrDuplicate", x.ID, err)
+	}
+
+	// The text index still points at X, so it survives removing a
+	store.Remove(a.ID)
+	if again, _ := store.Add("X"); again.ID != x.ID {
+		t.Errorf("Add(X) = %s, want the existing %s", again.ID, x.ID)
+	}
+	if commands, _ := store.Load(); len(commands) != 1 || commands[0].Text != "X" {
+		t.Errorf("Load() = %v, want only X", commands)
+	}
+}
+
+func TestBoltImportJSON(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "stash-bolt-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	jsonPath := filepath.Join(tmpDir, "commands.json")
+	legacy := &JSONStore{path: jsonPath}
+	legacy.Add("git status")
+	made, _ := legacy.Add("make test")
+	legacy.IncrementUse(made.ID, Place{})
+
+	store := NewBolt(filepath.Join(tmpDir, "commands.db"))
+	if err := store.ImportJSON(jsonPath); err != nil {
+		t.Fatalf("ImportJSON() error = %v", err)
+	}
+
+	commands, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(commands) != 2 || commands[0].ID != made.ID {
+		t.Errorf("List() = %v, want make test first with its ID kept", commands)
+	}
+
+	// A second import must not resurrect deleted commands
+	store.Remove(commands[1].ID)
+	if err := store.ImportJSON(jsonPath); err != nil {
+		t.Fatalf("ImportJSON() error = %v", err)
+	}
+	commands, _ = store.List()
+	if len(commands) != 1 {
+		t.Errorf("List() after re-import len = %d, want 1", len(commands))
+	}
+
+	// Once imported, the JSON file is not read again
+	os.WriteFile(jsonPath, []byte("{garbage"), 0644)
+	if err := store.ImportJSON(jsonPath); err != nil {
+		t.Errorf("ImportJSON() after the import error = %v, want the file left unread", err)
+	}
+}
+
+func TestBoltMigrateLegacyRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.db")
+
+	// Databases created before IDs keyed records by sequence number
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() error = %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket(commandsBucket)
+		tx.CreateBucket(textIndex)
+		tx.CreateBucket(legacyUsageIndex)
+		tx.CreateBucket(metaBucket)
+		data, _ := json.Marshal(map[string]any{"text": "echo legacy", "created_at": time.Now(), "use_count": 2})
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, 1)
+		return b.Put(key, data)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("seeding legacy db: %v", err)
+	}
+
+	store := NewBolt(path)
+	commands, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(commands) != 1 || commands[0].ID == "" || commands[0].UseCount != 2 {
+		t.Fatalf("List() = %+v, want migrated command with ID", commands)
+	}
+
+	if err := store.IncrementUse(commands[0].ID, Place{}); err != nil {
+		t.Fatalf("IncrementUse() error = %v", err)
+	}
+	cmd, _ := Resolve(store, commands[0].ID)
+	if cmd.UseCount != 3 {
+		t.Errorf("UseCount = %d, want 3", cmd.UseCount)
+	}
+
+	db, err = bolt.Open(path, 0644, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("bolt.Open() error = %v", err)
+	}
+	defer db.Close()
+	db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(legacyUsageIndex) != nil {
+			t.Error("migration should drop the legacy usage index")
+		}
+		return nil
+	})
+}
+
+func TestBoltLongCommand(t *testing.T) {
+	store := NewBolt(filepath.Join(t.TempDir(), "commands.db"))
+
+	// bbolt keys are limited to 32KB
+	long := "echo " + strings.Repeat("x", 40*1024)
+	added, err := store.Add(long)
+	if err != nil {
+		t.Fatalf("Add(40KB) error = %v", err)
+	}
+	again, err := store.Add(long)
+	if err != nil || again.ID != added.ID {
+		t.Errorf("Add(40KB) again = %s, %v, want %s", again.ID, err, added.ID)
+	}
+
+	other, _ := store.Add("ls")
+	other.Text = long
+	if err := store.Update(other); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Update() to the long text error = %v, want ErrDuplicate", err)
+	}
+}
+
+func TestBoltHashTextIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.db")
+	store := NewBolt(path)
+	added, _ := store.Add("git status")
+
+	// Older databases keyed the text index by the text itself
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() error = %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		tx.DeleteBucket(textIndex)
+		texts, _ := tx.CreateBucket(textIndex)
+		texts.Put([]byte("git status"), []byte(added.ID))
+		return tx.Bucket(metaBucket).Delete(textIndexKey)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("seeding raw text index: %v", err)
+	}
+
+	again, err := store.Add("git status")
+	if err != nil || again.ID != added.ID {
+		t.Errorf("Add() after rehashing = %s, %v, want %s", again.ID, err, added.ID)
+	}
+	if commands, _ := store.Load(); len(commands) != 1 {
+		t.Errorf("Load() = %v, want 1 command", commands)
+	}
+}
+
+func TestBoltSave(t *testing.T) {
+	store := NewBolt(filepath.Join(t.TempDir(), "commands.db"))
+	store.Add("git status")
+	logs, _ := store.Add("kubectl logs")
+	store.Update(Command{ID: logs.ID, Text: "kubectl logs", Tags: []string{"k8s"}, Description: "Logs"})
+	store.IncrementUse(logs.ID, Place{Dir: "/srv"})
+	before, _ := store.Load()
+
+	added, isNew, err := Save(store, Command{Text: "make test", Tags: []string{"ci"}})
+	if err != nil || !isNew {
+		t.Fatalf("Save() = %v, %v, want a new command", isNew, err)
+	}
+	again, isNew, err := Save(store, Command{Text: "make test", Tags: []string{"go"}, Description: "Tests"})
+	if err != nil || isNew || again.ID != added.ID {
+		t.Fatalf("Save() again = %s, %v, %v, want the existing %s", again.ID, isNew, err, added.ID)
+	}
+
+	// Saving touches only its own record and index entries
+	after, _ := store.Load()
+	byID := make(map[string]Command)
+	for _, cmd := range after {
+		byID[cmd.ID] = cmd
+	}
+	for _, cmd := range before {
+		got, ok := byID[cmd.ID]
+		if !ok || got.Text != cmd.Text || got.UseCount != cmd.UseCount || !got.CreatedAt.Equal(cmd.CreatedAt) || strings.Join(got.Tags, ",") != strings.Join(cmd.Tags, ",") {
+			t.Errorf("Save() changed %+v to %+v", cmd, got)
+		}
+	}
+	if saved := byID[added.ID]; strings.Join(saved.Tags, ",") != "ci,go" || saved.Description != "Tests" {
+		t.Errorf("saved command = %+v, want tags ci, go described Tests", saved)
+	}
+	if tagged, _ := store.ByTag("k8s"); len(tagged) != 1 || tagged[0].ID != logs.ID {
+		t.Errorf("ByTag(k8s) = %v, want kubectl logs", tagged)
+	}
+	if tagged, _ := store.ByTag("go"); len(tagged) != 1 || tagged[0].ID != added.ID {
+		t.Errorf("ByTag(go) = %v, want make test", tagged)
+	}
+}
+
+func TestBoltListSorted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.db")
+	store := NewBolt(path)
+	a, _ := store.Add("a")
+	b, _ := store.Add("b")
+	c, _ := store.Add("c")
+	store.IncrementUse(b.ID, Place{})
+	store.IncrementUse(b.ID, Place{})
+	store.IncrementUse(a.ID, Place{})
+
+	ids := func(commands []Command) string {
+		var s []string
+		for _, cmd := range commands {
+			s = append(s, cmd.ID)
+		}
+		return strings.Join(s, ",")
+	}
+	check := func(name string) {
+		t.Helper()
+		for order, want := range map[SortOrder][]Command{
+			SortCount:  {b, a, c},
+			SortRecent: {a, b, c},
+		} {
+			got, err := ListSorted(store, order, Place{})
+			if err != nil || ids(got) != ids(want) {
+				t.Errorf("%s: ListSorted(%s) = %s, %v, want %s", name, order, ids(got), err, ids(want))
+			}
+		}
+	}
+	check("indexed")
+
+	// Databases written before the usage indexes get them on upgrade
+	db, err := bolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open() error = %v", err)
+	}
+	db.Update(func(tx *bolt.Tx) error {
+		tx.DeleteBucket(countIndex)
+		return tx.DeleteBucket(recentIndex)
+	})
+	db.Close()
+	check("upgraded")
+}
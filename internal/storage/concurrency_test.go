@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const (
+	hammerWorkers = 8
+	hammerOps     = 25
+)
+
+// hammer adds a unique command and bumps a shared one hammerOps times
+func hammer(store *JSONStore, worker string) error {
+	shared, err := store.Add("shared")
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < hammerOps; i++ {
+		if _, err := store.Add(fmt.Sprintf("echo %s-%d", worker, i)); err != nil {
+			return err
+		}
+		if err := store.IncrementUse(shared.ID, Place{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestHelperProcess is not a real test: it is executed as a child process
+// by TestConcurrentProcesses to hammer the store from another process
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("STASH_HELPER_PROCESS") != "1" {
+		return
+	}
+
+	store := &JSONStore{path: os.Getenv("STASH_HELPER_PATH")}
+	if err := hammer(store, os.Getenv("STASH_HELPER_WORKER")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// checkHammered verifies that no Add or IncrementUse was lost
+func checkHammered(t *testing.T, store *JSONStore, workers int) {
+	t.Helper()
+
+	commands, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if want := workers*hammerOps + 1; len(commands) != want {
+		t.Errorf("Load() len = %d, want %d (lost Add)", len(commands), want)
+	}
+	for _, cmd := range commands {
+		if cmd.Text == "shared" && cmd.UseCount != workers*hammerOps {
+			t.Errorf("shared UseCount = %d, want %d (lost IncrementUse)", cmd.UseCount, workers*hammerOps)
+		}
+	}
+}
+
+func TestConcurrentGoroutines(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "commands.json")
+	(&JSONStore{path: path}).Add("shared")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, hammerWorkers)
+	for w := 0; w < hammerWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// Each goroutine opens its own store, like a separate terminal would
+			errs <- hammer(&JSONStore{path: path}, "g"+strconv.Itoa(w))
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("hammer() error = %v", err)
+		}
+	}
+
+	checkHammered(t, &JSONStore{path: path}, hammerWorkers)
+}
+
+func TestConcurrentProcesses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("spawns child processes")
+	}
+
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "commands.json")
+	(&JSONStore{path: path}).Add("shared")
+
+	const processes = 4
+	var cmds []*exec.Cmd
+	for p := 0; p < processes; p++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+		cmd.Env = append(os.Environ(),
+			"STASH_HELPER_PROCESS=1",
+			"STASH_HELPER_PATH="+path,
+			"STASH_HELPER_WORKER=p"+strconv.Itoa(p),
+		)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("Failed to start helper process: %v", err)
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("Helper process failed: %v", err)
+		}
+	}
+
+	checkHammered(t, &JSONStore{path: path}, processes)
+
+	// Temp files must not be left behind
+	matches, _ := filepath.Glob(filepath.Join(tmpDir, ".commands.json.tmp-*"))
+	if len(matches) != 0 {
+		t.Errorf("leftover temp files: %v", matches)
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// appName names the cli-stash directories under the XDG base directories
+const appName = "cli-stash"
+
+// dirOverride is set by SetDir and takes precedence over the environment
+var dirOverride string
+
+// SetDir makes Dir return dir, overriding CLI_STASH_DIR and the XDG
+// defaults. An empty dir restores the default lookup.
+func SetDir(dir string) {
+	dirOverride = dir
+}
+
+// Dir returns the stash directory, creating it if needed. It is the first of:
+// the directory set with SetDir, $CLI_STASH_DIR, $XDG_DATA_HOME/cli-stash
+// and ~/.local/share/cli-stash. A legacy ~/.stash directory is moved to the
+// XDG location the first time.
+func Dir() (string, error) {
+	stashDir, err := resolveDir()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(stashDir, 0755); err != nil {
+		return "", err
+	}
+
+	return stashDir, nil
+}
+
+func resolveDir() (string, error) {
+	if dirOverride != "" {
+		return dirOverride, nil
+	}
+	if dir := os.Getenv("CLI_STASH_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(xdgDir("XDG_DATA_HOME", homeDir, ".local", "share"), appName)
+	return migrateLegacyDir(filepath.Join(homeDir, ".stash"), dir), nil
+}
+
+// ConfigDir returns the cli-stash configuration directory,
+// $XDG_CONFIG_HOME/cli-stash or ~/.config/cli-stash. It is not created.
+func ConfigDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(xdgDir("XDG_CONFIG_HOME", homeDir, ".config"), appName), nil
+}
+
+// xdgDir returns the XDG base directory in env, or its default under
+// homeDir. Relative paths are invalid per the spec and ignored.
+func xdgDir(env, homeDir string, fallback ...string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(append([]string{homeDir}, fallback...)...)
+}
+
+// migrateLegacyDir moves the pre-XDG stash directory legacy to dir and
+// returns the directory to use. If dir already exists it wins; if the move
+// fails (e.g. across file systems) the legacy directory stays in use.
+func migrateLegacyDir(legacy, dir string) string {
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	if info, err := os.Stat(legacy); err != nil || !info.IsDir() {
+		return dir
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return legacy
+	}
+	if err := os.Rename(legacy, dir); err != nil {
+		return legacy
+	}
+	return dir
+}
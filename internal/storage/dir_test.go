@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useDir points Dir at dir for the duration of the test
+func useDir(t *testing.T, dir string) {
+	t.Helper()
+	SetDir(dir)
+	t.Cleanup(func() { SetDir("") })
+}
+
+func TestDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLI_STASH_DIR", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+
+	t.Run("Default", func(t *testing.T) {
+		if got, want := mustDir(t), filepath.Join(home, ".local", "share", "cli-stash"); got != want {
+			t.Errorf("Dir() = %s, want %s", got, want)
+		}
+		if got, _ := ConfigDir(); got != filepath.Join(home, ".config", "cli-stash") {
+			t.Errorf("ConfigDir() = %s", got)
+		}
+	})
+
+	t.Run("XDG", func(t *testing.T) {
+		t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "conf"))
+		if got, want := mustDir(t), filepath.Join(home, "data", "cli-stash"); got != want {
+			t.Errorf("Dir() = %s, want %s", got, want)
+		}
+		if got, _ := ConfigDir(); got != filepath.Join(home, "conf", "cli-stash") {
+			t.Errorf("ConfigDir() = %s", got)
+		}
+
+		// Relative XDG paths are ignored
+		t.Setenv("XDG_DATA_HOME", "relative")
+		if got, want := mustDir(t), filepath.Join(home, ".local", "share", "cli-stash"); got != want {
+			t.Errorf("Dir() = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		env := filepath.Join(home, "env")
+		t.Setenv("CLI_STASH_DIR", env)
+		if got := mustDir(t); got != env {
+			t.Errorf("Dir() = %s, want %s", got, env)
+		}
+
+		flag := filepath.Join(home, "flag")
+		useDir(t, flag)
+		if got := mustDir(t); got != flag {
+			t.Errorf("Dir() = %s, want %s", got, flag)
+		}
+	})
+}
+
+func TestMigrateLegacyDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLI_STASH_DIR", "")
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+
+	legacy := filepath.Join(home, ".stash")
+	os.Mkdir(legacy, 0755)
+	NewAt(filepath.Join(legacy, "commands.json")).Add("git status")
+
+	store, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	commands, err := store.Load()
+	if err != nil || len(commands) != 1 || commands[0].Text != "git status" {
+		t.Errorf("Load() after migration = %v, %v; want the legacy command", commands, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("the legacy directory should have been moved")
+	}
+	if store.path != filepath.Join(home, "data", "cli-stash", "commands.json") {
+		t.Errorf("New() path = %s, want the XDG data directory", store.path)
+	}
+
+	// A legacy directory reappearing later doesn't replace the migrated one
+	os.Mkdir(legacy, 0755)
+	if got := mustDir(t); got != filepath.Join(home, "data", "cli-stash") {
+		t.Errorf("Dir() = %s, want the XDG data directory", got)
+	}
+}
+
+func mustDir(t *testing.T) string {
+	t.Helper()
+	dir, err := Dir()
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	return dir
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SortOrder selects how commands are ordered
+type SortOrder string
+
+// Supported sort orders
+const (
+	SortFrecency SortOrder = "frecency"
+	SortCount    SortOrder = "count"
+	SortRecent   SortOrder = "recent"
+	SortAlpha    SortOrder = "alpha"
+)
+
+// SortOrders lists every sort order, in the order the UI cycles through them
+var SortOrders = []SortOrder{SortFrecency, SortCount, SortRecent, SortAlpha}
+
+// maxUseHistory caps the use timestamps kept per command. Older uses
+// still count through UseCount, at the lowest weight.
+const maxUseHistory = 50
+
+// ParseSortOrder validates a sort order name; "" selects frecency
+func ParseSortOrder(s string) (SortOrder, error) {
+	if s == "" {
+		return SortFrecency, nil
+	}
+	for _, order := range SortOrders {
+		if string(order) == s {
+			return order, nil
+		}
+	}
+	return "", fmt.Errorf("unknown sort order %q (want frecency, count, recent or alpha)", s)
+}
+
+// Next returns the sort order after o, wrapping around
+func (o SortOrder) Next() SortOrder {
+	for i, order := range SortOrders {
+		if order == o {
+			return SortOrders[(i+1)%len(SortOrders)]
+		}
+	}
+	return SortFrecency
+}
+
+// Frecency scores how frequently and recently a command was used. Like
+// zoxide, each use is weighted by its age: uses within the last hour count
+// four times, the last day twice, the last week once, the last month half
+// and older uses a tenth, so habits that changed stop dominating the list.
+func (c Command) Frecency(now time.Time) float64 {
+	score := 0.0
+	for _, used := range c.Uses {
+		score += useWeight(now.Sub(used))
+	}
+	// Uses without a timestamp predate the time series or were trimmed from it
+	if untimed := c.UseCount - len(c.Uses); untimed > 0 {
+		score += float64(untimed) * useWeight(time.Duration(1<<63-1))
+	}
+	return score
+}
+
+func useWeight(age time.Duration) float64 {
+	switch {
+	case age < time.Hour:
+		return 4
+	case age < 24*time.Hour:
+		return 2
+	case age < 7*24*time.Hour:
+		return 1
+	case age < 30*24*time.Hour:
+		return 0.5
+	default:
+		return 0.1
+	}
+}
+
+// Relevance is the frecency of c boosted by how close place is to where
+// the command was used before
+func (c Command) Relevance(now time.Time, place Place) float64 {
+	return c.Frecency(now) * c.placeBoost(place)
+}
+
+// recordUse counts a use of cmd at now and place
+func recordUse(cmd *Command, now time.Time, place Place) {
+	recordPlace(cmd, place)
+	cmd.UseCount++
+	cmd.LastUsedAt = now
+	cmd.Uses = append(cmd.Uses, now)
+	if len(cmd.Uses) > maxUseHistory {
+		cmd.Uses = cmd.Uses[len(cmd.Uses)-maxUseHistory:]
+	}
+}
+
+// Sort orders commands in place. The frecency order ranks commands used at
+// place higher. Ties fall back to the newest command first.
+func Sort(commands []Command, order SortOrder, place Place) {
+	switch order {
+	case SortCount:
+		sortByUsage(commands)
+	case SortRecent:
+		sort.SliceStable(commands, func(i, j int) bool {
+			if !commands[i].LastUsedAt.Equal(commands[j].LastUsedAt) {
+				return commands[i].LastUsedAt.After(commands[j].LastUsedAt)
+			}
+			return commands[i].CreatedAt.After(commands[j].CreatedAt)
+		})
+	case SortAlpha:
+		sort.SliceStable(commands, func(i, j int) bool {
+			return strings.ToLower(commands[i].Text) < strings.ToLower(commands[j].Text)
+		})
+	default:
+		now := time.Now()
+		scores := make(map[string]float64, len(commands))
+		for _, cmd := range commands {
+			scores[cmd.ID] = cmd.Relevance(now, place)
+		}
+		sort.SliceStable(commands, func(i, j int) bool {
+			a, b := commands[i], commands[j]
+			if scores[a.ID] != scores[b.ID] {
+				return scores[a.ID] > scores[b.ID]
+			}
+			if !a.LastUsedAt.Equal(b.LastUsedAt) {
+				return a.LastUsedAt.After(b.LastUsedAt)
+			}
+			return a.CreatedAt.After(b.CreatedAt)
+		})
+	}
+}
+
+// sortedLister is implemented by backends that index some sort orders
+type sortedLister interface {
+	ListSorted(order SortOrder, place Place) ([]Command, error)
+}
+
+// ListSorted returns the commands of b in the given order. Backends with
+// a usage index read the count and recent orders from it; others are
+// sorted in memory.
+func ListSorted(b Backend, order SortOrder, place Place) ([]Command, error) {
+	if sl, ok := b.(sortedLister); ok {
+		return sl.ListSorted(order, place)
+	}
+
+	commands, err := b.Load()
+	if err != nil {
+		return nil, err
+	}
+	Sort(commands, order, place)
+	return commands, nil
+}
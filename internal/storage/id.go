@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// idLength is the number of hex characters in a command ID
+const idLength = 8
+
+// ErrNotFound is returned when no command matches an ID
+var ErrNotFound = errors.New("command not found")
+
+// randomID returns a new random command ID
+func randomID() string {
+	b := make([]byte, idLength/2)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
+
+// newID returns a random ID not used by any of commands
+func newID(commands []Command) string {
+	for {
+		id := randomID()
+		unique := true
+		for _, cmd := range commands {
+			if cmd.ID == id {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return id
+		}
+	}
+}
+
+// Find returns the command whose ID equals ref or, failing that, the only
+// command whose ID starts with ref (like abbreviated git hashes)
+func Find(commands []Command, ref string) (Command, error) {
+	ref = strings.ToLower(strings.TrimSpace(ref))
+	if ref == "" {
+		return Command{}, ErrNotFound
+	}
+
+	var matches []Command
+	for _, cmd := range commands {
+		if cmd.ID == ref {
+			return cmd, nil
+		}
+		if strings.HasPrefix(cmd.ID, ref) {
+			matches = append(matches, cmd)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Command{}, fmt.Errorf("%w: %s", ErrNotFound, ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return Command{}, fmt.Errorf("ambiguous ID %q matches %d commands", ref, len(matches))
+	}
+}
+
+// Resolve looks up a command in b by full or abbreviated ID
+func Resolve(b Backend, ref string) (Command, error) {
+	commands, err := b.Load()
+	if err != nil {
+		return Command{}, err
+	}
+	return Find(commands, ref)
+}
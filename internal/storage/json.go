@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// JSONStore is a Backend that keeps all commands in a single JSON file
+type JSONStore struct {
+	path string
+	// view stores only read: they take no lock, relying on writes being
+	// atomic renames, so they work in read-only directories
+	view bool
+}
+
+// New creates a JSONStore backed by commands.json in the stash directory,
+// upgrading a file written with an older schema
+func New() (*JSONStore, error) {
+	stashDir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	store := NewAt(filepath.Join(stashDir, "commands.json"))
+	if err := store.Upgrade(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewAt creates a JSONStore backed by the commands file at path. Call
+// Upgrade before using a file that may have an older schema.
+func NewAt(path string) *JSONStore {
+	return &JSONStore{path: path}
+}
+
+// jsonView returns a JSONStore that reads the file at path without ever
+// writing it
+func jsonView(path string) *JSONStore {
+	return &JSONStore{path: path, view: true}
+}
+
+// Load reads all commands from storage. Files written with an older
+// schema are migrated in memory only; Upgrade writes the migration.
+func (s *JSONStore) Load() ([]Command, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	commands, _, err := decodeCommands(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	return commands, nil
+}
+
+// Upgrade rewrites a file written with an older schema in the current
+// one, keeping a backup of the original. Migrations may assign values
+// such as IDs, which only stay the same from one load to the next once
+// the upgrade is written.
+func (s *JSONStore) Upgrade() error {
+	data, err := s.read()
+	if err != nil || data == nil {
+		return err
+	}
+	_, version, err := decodeCommands(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	if version >= SchemaVersion {
+		return nil
+	}
+
+	return s.Transaction(func(commands []Command) ([]Command, error) {
+		return commands, nil
+	})
+}
+
+// read returns the raw commands file under a shared lock, or without one
+// for views
+func (s *JSONStore) read() ([]byte, error) {
+	if s.view {
+		return s.readFile()
+	}
+	lock, err := lockFile(s.path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+	return s.readFile()
+}
+
+// Save writes all commands to storage
+func (s *JSONStore) Save(commands []Command) error {
+	if s.view {
+		return ErrReadOnly
+	}
+	lock, err := lockFile(s.path, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	data, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	_, version, err := decodeCommands(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	return s.write(data, version, commands)
+}
+
+// Transaction loads all commands, passes them to fn and saves the result.
+// The whole cycle runs under an exclusive lock, so concurrent processes
+// cannot overwrite each other's changes.
+func (s *JSONStore) Transaction(fn func(commands []Command) ([]Command, error)) error {
+	if s.view {
+		return ErrReadOnly
+	}
+	lock, err := lockFile(s.path, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	data, err := s.readFile()
+	if err != nil {
+		return err
+	}
+	commands, version, err := decodeCommands(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	if version > SchemaVersion {
+		return &SchemaError{Path: s.path, Version: version}
+	}
+
+	commands, err = fn(commands)
+	if err != nil {
+		return err
+	}
+
+	return s.write(data, version, commands)
+}
+
+// readFile returns the raw commands file, or nil if it doesn't exist yet.
+// The caller must hold the lock.
+func (s *JSONStore) readFile() ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// write atomically replaces the commands file. old and version describe the
+// current file contents: newer schemas are never overwritten, and older ones
+// are backed up before being replaced. The caller must hold the lock.
+func (s *JSONStore) write(old []byte, version int, commands []Command) error {
+	if version > SchemaVersion {
+		return &SchemaError{Path: s.path, Version: version}
+	}
+
+	if old != nil && version < SchemaVersion {
+		backup := fmt.Sprintf("%s.v%d.bak", s.path, version)
+		if err := writeFileAtomic(backup, old, 0644); err != nil {
+			return fmt.Errorf("backing up %s: %w", s.path, err)
+		}
+	}
+
+	data, err := encodeCommands(commands)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.path, data, 0644)
+}
+
+// Add appends a new command to storage
+func (s *JSONStore) Add(text string) (Command, error) {
+	var added Command
+	err := s.Transaction(func(commands []Command) ([]Command, error) {
+		// Check if command already exists
+		for _, cmd := range commands {
+			if cmd.Text == text {
+				added = cmd
+				return commands, nil // Already exists, skip
+			}
+		}
+
+		added = Command{
+			ID:        newID(commands),
+			Text:      text,
+			CreatedAt: time.Now(),
+			UseCount:  0,
+		}
+		return append(commands, added), nil
+	})
+	return added, err
+}
+
+// Remove deletes a command from storage
+func (s *JSONStore) Remove(id string) error {
+	return s.Transaction(func(commands []Command) ([]Command, error) {
+		filtered := make([]Command, 0, len(commands))
+		for _, cmd := range commands {
+			if cmd.ID != id {
+				filtered = append(filtered, cmd)
+			}
+		}
+		return filtered, nil
+	})
+}
+
+// Update replaces the command text, tags and description, preserving
+// metadata. It fails with ErrDuplicate if another command has the text.
+func (s *JSONStore) Update(updated Command) error {
+	return s.Transaction(func(commands []Command) ([]Command, error) {
+		for _, cmd := range commands {
+			if cmd.Text == updated.Text && cmd.ID != updated.ID {
+				return nil, duplicateError(cmd.ID)
+			}
+		}
+		for i, cmd := range commands {
+			if cmd.ID == updated.ID {
+				commands[i].Text = updated.Text
+				commands[i].Tags = NormalizeTags(updated.Tags)
+				commands[i].Description = strings.TrimSpace(updated.Description)
+				break
+			}
+		}
+		return commands, nil
+	})
+}
+
+// IncrementUse records a use of a command at place
+func (s *JSONStore) IncrementUse(id string, place Place) error {
+	now := time.Now()
+	return s.Transaction(func(commands []Command) ([]Command, error) {
+		for i, cmd := range commands {
+			if cmd.ID == id {
+				recordUse(&commands[i], now, place)
+				break
+			}
+		}
+		return commands, nil
+	})
+}
+
+// List returns all commands sorted by frecency (most relevant first),
+// boosting those used in the current directory or repository
+func (s *JSONStore) List() ([]Command, error) {
+	commands, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	Sort(commands, SortFrecency, CurrentPlace())
+	return commands, nil
+}
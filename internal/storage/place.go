@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// maxPlaces caps the directories and repositories remembered per command;
+// the least used ones are forgotten first
+const maxPlaces = 50
+
+// Place is where a command was used: the working directory and, inside a
+// git repository, the repository root
+type Place struct {
+	Dir  string
+	Repo string
+}
+
+// CurrentPlace returns the place of the current working directory
+func CurrentPlace() Place {
+	dir, err := os.Getwd()
+	if err != nil {
+		return Place{}
+	}
+	return PlaceOf(dir)
+}
+
+// PlaceOf returns the place of dir, finding its git repository root by
+// walking up to the nearest directory containing .git
+func PlaceOf(dir string) Place {
+	if dir == "" {
+		return Place{}
+	}
+	place := Place{Dir: filepath.Clean(dir)}
+	for d := place.Dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			place.Repo = d
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return place
+}
+
+// placeBoost multiplies the frecency of commands used at place: uses in
+// the same directory count most, uses elsewhere in the same repository less
+func (c Command) placeBoost(place Place) float64 {
+	switch {
+	case place.Dir != "" && c.Dirs[place.Dir] > 0:
+		return 4
+	case place.Repo != "" && c.Repos[place.Repo] > 0:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// recordPlace counts a use at place
+func recordPlace(cmd *Command, place Place) {
+	if place.Dir != "" {
+		cmd.Dirs = countPlace(cmd.Dirs, place.Dir)
+	}
+	if place.Repo != "" {
+		cmd.Repos = countPlace(cmd.Repos, place.Repo)
+	}
+}
+
+func countPlace(counts map[string]int, key string) map[string]int {
+	if counts == nil {
+		counts = make(map[string]int)
+	}
+	counts[key]++
+
+	if len(counts) > maxPlaces {
+		keys := make([]string, 0, len(counts))
+		for k := range counts {
+			if k != key {
+				keys = append(keys, k)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if counts[keys[i]] != counts[keys[j]] {
+				return counts[keys[i]] < counts[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys[:len(counts)-maxPlaces] {
+			delete(counts, k)
+		}
+	}
+	return counts
+}
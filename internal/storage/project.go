@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ProjectFileNames are the names of checked-in project stash files
+var ProjectFileNames = []string{".stash.json", ".stash.toml"}
+
+// ProjectFiles returns the project stash files found in dir and its
+// parents, nearest first
+func ProjectFiles(dir string) []string {
+	if dir == "" {
+		return nil
+	}
+
+	var files []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		for _, name := range ProjectFileNames {
+			path := filepath.Join(d, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				files = append(files, path)
+			}
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return files
+}
+
+// projectCommand is a command as written in a project stash file
+type projectCommand struct {
+	Text        string   `json:"text" toml:"text"`
+	Description string   `json:"description" toml:"description"`
+	Tags        []string `json:"tags" toml:"tags"`
+}
+
+// projectFile is the layout of a project stash file. JSON files may also
+// be a bare array of commands.
+type projectFile struct {
+	Commands []projectCommand `json:"commands" toml:"commands"`
+}
+
+// projectLoader reads a checked-in project stash file. Its commands carry
+// the file path as their Origin and IDs derived from their text, so they
+// are the same in every clone of the repository.
+type projectLoader struct {
+	path string
+}
+
+// NewProject creates a read-only Backend for the .stash.json or
+// .stash.toml file at path
+func NewProject(path string) Backend {
+	return readOnly{reader: &projectLoader{path: path}}
+}
+
+// Load parses the project file
+func (s *projectLoader) Load() ([]Command, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file projectFile
+	if strings.HasSuffix(s.path, ".toml") {
+		err = toml.Unmarshal(data, &file)
+	} else if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &file.Commands)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	var modTime time.Time
+	if info, err := os.Stat(s.path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	commands := make([]Command, 0, len(file.Commands))
+	seen := make(map[string]bool)
+	for _, pc := range file.Commands {
+		text := strings.TrimSpace(pc.Text)
+		if text == "" || seen[text] {
+			continue
+		}
+		seen[text] = true
+		commands = append(commands, Command{
+			ID:          projectID(text),
+			Text:        text,
+			Tags:        NormalizeTags(pc.Tags),
+			Description: strings.TrimSpace(pc.Description),
+			CreatedAt:   modTime,
+			Origin:      s.path,
+		})
+	}
+	return commands, nil
+}
+
+// List returns the project commands sorted by frecency
+func (s *projectLoader) List() ([]Command, error) {
+	commands, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	Sort(commands, SortFrecency, CurrentPlace())
+	return commands, nil
+}
+
+// projectID derives a stable ID from the command text
+func projectID(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])[:idLength]
+}
+
+// Merged combines the personal stash with read-only project stashes.
+// Writes go to the personal stash; project commands whose text is also
+// saved personally are hidden behind the personal copy.
+type Merged struct {
+	personal Backend
+	projects []Backend
+	skipped  []error // project files the last Load could not read
+}
+
+// Merge returns a Backend showing the commands of personal and projects
+func Merge(personal Backend, projects ...Backend) *Merged {
+	return &Merged{personal: personal, projects: projects}
+}
+
+// WithProjectFiles merges personal with the project stash files found by
+// walking up from dir
+func WithProjectFiles(personal Backend, dir string) Backend {
+	files := ProjectFiles(dir)
+	if len(files) == 0 {
+		return personal
+	}
+
+	projects := make([]Backend, len(files))
+	for i, path := range files {
+		projects[i] = NewProject(path)
+	}
+	return Merge(personal, projects...)
+}
+
+// Load returns the personal commands followed by the project ones. A
+// project file that can't be read or parsed is left out and reported by
+// Skipped, so one broken checked-in file doesn't break the personal stash.
+func (m *Merged) Load() ([]Command, error) {
+	commands, err := m.personal.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	m.skipped = nil
+	seen := make(map[string]bool, len(commands))
+	for _, cmd := range commands {
+		seen[cmd.Text] = true
+	}
+	for _, project := range m.projects {
+		projectCommands, err := project.Load()
+		if err != nil {
+			m.skipped = append(m.skipped, err)
+			continue
+		}
+		for _, cmd := range projectCommands {
+			if !seen[cmd.Text] {
+				seen[cmd.Text] = true
+				commands = append(commands, cmd)
+			}
+		}
+	}
+	return commands, nil
+}
+
+// Skipped returns the errors of the project files the last Load left out
+func (m *Merged) Skipped() []error {
+	return m.skipped
+}
+
+// Skipped returns the errors of the project files b left out when it was
+// last loaded, if b merges project files
+func Skipped(b Backend) []error {
+	if m, ok := b.(*Merged); ok {
+		return m.Skipped()
+	}
+	return nil
+}
+
+// List returns all commands sorted by frecency (most relevant first),
+// boosting those used in the current directory or repository
+func (m *Merged) List() ([]Command, error) {
+	commands, err := m.Load()
+	if err != nil {
+		return nil, err
+	}
+	Sort(commands, SortFrecency, CurrentPlace())
+	return commands, nil
+}
+
+// Add saves a command in the personal stash
+func (m *Merged) Add(text string) (Command, error) {
+	return m.personal.Add(text)
+}
+
+// Upsert saves a command in the personal stash like Save
+func (m *Merged) Upsert(cmd Command) (Command, bool, error) {
+	return Save(m.personal, cmd)
+}
+
+// Remove deletes a personal command; project commands can't be removed
+func (m *Merged) Remove(id string) error {
+	if err := m.checkWritable(id); err != nil {
+		return err
+	}
+	return m.personal.Remove(id)
+}
+
+// Update edits a personal command; project commands can't be edited
+func (m *Merged) Update(cmd Command) error {
+	if err := m.checkWritable(cmd.ID); err != nil {
+		return err
+	}
+	return m.personal.Update(cmd)
+}
+
+// IncrementUse records a use of a personal command. Uses of project
+// commands are not recorded, since project files are never written.
+func (m *Merged) IncrementUse(id string, place Place) error {
+	if err := m.checkWritable(id); err != nil {
+		return err
+	}
+	return m.personal.IncrementUse(id, place)
+}
+
+// Transaction runs fn over the personal commands only
+func (m *Merged) Transaction(fn func(commands []Command) ([]Command, error)) error {
+	return m.personal.Transaction(fn)
+}
+
+// checkWritable fails with ErrReadOnly if id is a project command
+func (m *Merged) checkWritable(id string) error {
+	commands, err := m.Load()
+	if err != nil {
+		return err
+	}
+	for _, cmd := range commands {
+		if cmd.ID == id && cmd.Origin != "" {
+			return fmt.Errorf("command %s comes from %s: %w", id, cmd.Origin, ErrReadOnly)
+		}
+	}
+	return nil
+}
+
+// ErrNotProject is returned when promoting a command that is already personal
+var ErrNotProject = errors.New("command is already in your stash")
+
+// Promote copies the project command cmd, with its tags and description,
+// into the personal stash of b and returns the personal copy
+func Promote(b Backend, cmd Command) (Command, error) {
+	if cmd.Origin == "" {
+		return Command{}, ErrNotProject
+	}
+
+	added, err := b.Add(cmd.Text)
+	if err != nil {
+		return Command{}, err
+	}
+	added.Tags = NormalizeTags(append(added.Tags, cmd.Tags...))
+	if added.Description == "" {
+		added.Description = cmd.Description
+	}
+	if err := b.Update(added); err != nil {
+		return Command{}, err
+	}
+	return added, nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProjectFiles(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "services", "api")
+	os.MkdirAll(sub, 0755)
+
+	os.WriteFile(filepath.Join(root, ".stash.toml"), []byte(`
+[[commands]]
+text = "make migrate"
+description = "Run database migrations"
+tags = ["DB"]
+
+[[commands]]
+text = "make deploy"
+`), 0644)
+	os.WriteFile(filepath.Join(sub, ".stash.json"), []byte(`[
+		{"text": "go test ./...", "tags": ["test"]},
+		{"text": "make deploy", "description": "Deploy the API only"}
+	]`), 0644)
+
+	files := ProjectFiles(sub)
+	want := []string{filepath.Join(sub, ".stash.json"), filepath.Join(root, ".stash.toml")}
+	if len(files) != 2 || files[0] != want[0] || files[1] != want[1] {
+		t.Fatalf("ProjectFiles() = %v, want %v", files, want)
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		commands, err := NewProject(files[1]).Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if len(commands) != 2 {
+			t.Fatalf("Load() len = %d, want 2", len(commands))
+		}
+		migrate := commands[0]
+		if migrate.Description != "Run database migrations" || !migrate.HasTag("db") || migrate.Origin != files[1] {
+			t.Errorf("Load() = %+v, want description, db tag and origin", migrate)
+		}
+
+		again, _ := NewProject(files[1]).Load()
+		if again[0].ID != migrate.ID {
+			t.Errorf("Load() IDs differ between loads: %s, %s", migrate.ID, again[0].ID)
+		}
+
+		if err := NewProject(files[1]).Update(migrate); err != ErrReadOnly {
+			t.Errorf("Update() error = %v, want ErrReadOnly", err)
+		}
+	})
+
+	t.Run("Merged", func(t *testing.T) {
+		personal := &JSONStore{path: filepath.Join(t.TempDir(), "commands.json")}
+		personal.Add("go test ./...")
+		store := WithProjectFiles(personal, sub)
+
+		commands, err := store.Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		// go test is personal, make deploy comes from the nearest file
+		if len(commands) != 3 {
+			t.Fatalf("Load() = %v, want 3 commands", commands)
+		}
+		byText := make(map[string]Command)
+		for _, cmd := range commands {
+			byText[cmd.Text] = cmd
+		}
+		if byText["go test ./..."].Origin != "" {
+			t.Error("personal commands should hide project commands with the same text")
+		}
+		if byText["make deploy"].Description != "Deploy the API only" {
+			t.Errorf("make deploy = %+v, want the nearest project file to win", byText["make deploy"])
+		}
+
+		migrate := byText["make migrate"]
+		if err := store.Remove(migrate.ID); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Remove(project) error = %v, want ErrReadOnly", err)
+		}
+		if err := store.IncrementUse(migrate.ID, Place{}); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("IncrementUse(project) error = %v, want ErrReadOnly", err)
+		}
+
+		promoted, err := Promote(store, migrate)
+		if err != nil {
+			t.Fatalf("Promote() error = %v", err)
+		}
+		if promoted.Origin != "" || !promoted.HasTag("db") || promoted.Description != migrate.Description {
+			t.Errorf("Promote() = %+v, want a personal copy with tags and description", promoted)
+		}
+		if _, err := Promote(store, promoted); !errors.Is(err, ErrNotProject) {
+			t.Errorf("Promote(personal) error = %v, want ErrNotProject", err)
+		}
+
+		commands, _ = store.Load()
+		if len(commands) != 3 {
+			t.Errorf("Load() after Promote len = %d, want 3", len(commands))
+		}
+		if err := store.Remove(promoted.ID); err != nil {
+			t.Errorf("Remove(promoted) error = %v", err)
+		}
+	})
+
+	t.Run("Broken", func(t *testing.T) {
+		root := t.TempDir()
+		sub := filepath.Join(root, "app")
+		os.MkdirAll(sub, 0755)
+		broken := filepath.Join(root, ".stash.json")
+		os.WriteFile(broken, []byte(`{"commands": garbage}`), 0644)
+		os.WriteFile(filepath.Join(sub, ".stash.json"), []byte(`[{"text": "make test"}]`), 0644)
+
+		personal := &JSONStore{path: filepath.Join(t.TempDir(), "commands.json")}
+		personal.Add("ls -la")
+		store := WithProjectFiles(personal, sub)
+
+		commands, err := store.List()
+		if err != nil {
+			t.Fatalf("List() with a broken project file error = %v", err)
+		}
+		if len(commands) != 2 {
+			t.Errorf("List() = %v, want the personal and the readable project command", commands)
+		}
+		skipped := Skipped(store)
+		if len(skipped) != 1 || !strings.Contains(skipped[0].Error(), broken) {
+			t.Errorf("Skipped() = %v, want the error of %s", skipped, broken)
+		}
+		if _, err := store.Add("make lint"); err != nil {
+			t.Errorf("Add() with a broken project file error = %v", err)
+		}
+
+		os.WriteFile(broken, []byte(`[{"text": "make deploy"}]`), 0644)
+		if commands, _ := store.Load(); len(commands) != 4 || len(Skipped(store)) != 0 {
+			t.Errorf("Load() after fixing the file = %v, skipped %v", commands, Skipped(store))
+		}
+	})
+
+	t.Run("NoFiles", func(t *testing.T) {
+		personal := &JSONStore{path: filepath.Join(t.TempDir(), "commands.json")}
+		if store := WithProjectFiles(personal, t.TempDir()); store != Backend(personal) {
+			t.Error("WithProjectFiles() without project files should return the personal store")
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the commands file format written by
+// this binary. Bump it and register a migration whenever Command changes.
+//
+// History:
+//
+//	1: bare JSON array of commands
+//	2: {"version": N, "commands": [...]} envelope
+//	3: stable "id" on every command
+//	4: optional "tags"
+//	5: optional "description"
+//	6: optional "last_used_at" and "uses" for frecency
+//	7: optional "dirs" and "repos" use counts
+const SchemaVersion = 7
+
+// document is the version-independent form of a commands file. Commands are
+// kept as generic records so migrations don't depend on the current Command.
+type document struct {
+	Version  int              `json:"version"`
+	Commands []map[string]any `json:"commands"`
+}
+
+// envelope is the on-disk form written by this binary
+type envelope struct {
+	Version  int       `json:"version"`
+	Commands []Command `json:"commands"`
+}
+
+// migrations[v] upgrades a document from schema version v to v+1
+var migrations = map[int]func(doc *document) error{
+	1: func(doc *document) error { return nil }, // the envelope itself is the change
+	2: func(doc *document) error {
+		seen := make(map[string]bool)
+		for _, record := range doc.Commands {
+			id, _ := record["id"].(string)
+			for id == "" || seen[id] {
+				id = randomID()
+			}
+			seen[id] = true
+			record["id"] = id
+		}
+		return nil
+	},
+	3: func(doc *document) error { return nil }, // tags are optional
+	4: func(doc *document) error { return nil }, // descriptions are optional
+	5: func(doc *document) error { return nil }, // untimed uses count as old
+	6: func(doc *document) error { return nil }, // places are optional
+}
+
+// SchemaError is returned when a commands file was written by a newer
+// cli-stash and this binary would lose data by rewriting it
+type SchemaError struct {
+	Path    string
+	Version int
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s uses schema version %d, but this cli-stash only supports up to version %d; upgrade cli-stash to modify it",
+		e.Path, e.Version, SchemaVersion)
+}
+
+// decodeCommands parses a commands file of any known version, migrating it
+// to SchemaVersion in memory. It returns the version found on disk. Files
+// newer than SchemaVersion are decoded on a best-effort basis.
+func decodeCommands(data []byte) ([]Command, int, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return []Command{}, SchemaVersion, nil
+	}
+
+	var doc document
+	if data[0] == '[' {
+		doc.Version = 1
+		if err := json.Unmarshal(data, &doc.Commands); err != nil {
+			return nil, 0, err
+		}
+	} else if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	version := doc.Version
+	if err := doc.upgrade(); err != nil {
+		return nil, version, err
+	}
+
+	commands, err := doc.commands()
+	return commands, version, err
+}
+
+// upgrade runs the migrations needed to bring doc to SchemaVersion
+func (doc *document) upgrade() error {
+	for doc.Version < SchemaVersion {
+		migrate, ok := migrations[doc.Version]
+		if !ok {
+			return fmt.Errorf("no migration from schema version %d", doc.Version)
+		}
+		if err := migrate(doc); err != nil {
+			return fmt.Errorf("migrating schema version %d: %w", doc.Version, err)
+		}
+		doc.Version++
+	}
+	return nil
+}
+
+// commands round-trips the generic records into the current Command type
+func (doc *document) commands() ([]Command, error) {
+	raw, err := json.Marshal(doc.Commands)
+	if err != nil {
+		return nil, err
+	}
+	commands := []Command{}
+	if err := json.Unmarshal(raw, &commands); err != nil {
+		return nil, err
+	}
+	return commands, nil
+}
+
+// encodeCommands renders commands in the current schema
+func encodeCommands(commands []Command) ([]byte, error) {
+	if commands == nil {
+		commands = []Command{}
+	}
+	return json.MarshalIndent(envelope{Version: SchemaVersion, Commands: commands}, "", "  ")
+}
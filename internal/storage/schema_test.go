@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateLegacyArray(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "commands.json")
+
+	legacy := `[{"text": "echo hello", "created_at": "2024-01-02T03:04:05Z", "use_count": 3}]`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatalf("Failed to write legacy file: %v", err)
+	}
+
+	// Loading migrates in memory only
+	store := &JSONStore{path: path}
+	commands, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(commands) != 1 || commands[0].Text != "echo hello" || commands[0].UseCount != 3 {
+		t.Fatalf("Load() = %+v, want migrated legacy command", commands)
+	}
+	if commands[0].ID == "" {
+		t.Error("Load() did not assign an ID to the legacy command")
+	}
+	if data, _ := os.ReadFile(path); string(data) != legacy {
+		t.Errorf("Load() rewrote the file: %s", data)
+	}
+
+	if err := store.Upgrade(); err != nil {
+		t.Fatalf("Upgrade() error = %v", err)
+	}
+	commands, _ = store.Load()
+
+	// IDs assigned by the migration are stable
+	again, _ := store.Load()
+	if again[0].ID != commands[0].ID {
+		t.Errorf("ID changed between loads: %q != %q", again[0].ID, commands[0].ID)
+	}
+
+	// The file is upgraded in place
+	data, _ := os.ReadFile(path)
+	var env struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &env); err != nil || env.Version != SchemaVersion {
+		t.Errorf("upgraded file version = %d (err %v), want %d", env.Version, err, SchemaVersion)
+	}
+
+	// And the original is kept as a backup
+	backup, err := os.ReadFile(path + ".v1.bak")
+	if err != nil {
+		t.Fatalf("backup not written: %v", err)
+	}
+	if string(backup) != legacy {
+		t.Errorf("backup = %q, want original contents", backup)
+	}
+}
+
+func TestRefuseNewerSchema(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "commands.json")
+
+	newer := `{"version": 999, "commands": [{"text": "echo future", "shiny": true}]}`
+	if err := os.WriteFile(path, []byte(newer), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	store := &JSONStore{path: path}
+
+	// Reading is allowed on a best-effort basis
+	commands, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(commands) != 1 || commands[0].Text != "echo future" {
+		t.Errorf("Load() = %+v, want best-effort decode", commands)
+	}
+
+	// Writing is refused
+	var schemaErr *SchemaError
+	if _, err := store.Add("echo now"); !errors.As(err, &schemaErr) {
+		t.Errorf("Add() error = %v, want *SchemaError", err)
+	}
+	if err := store.Save(nil); !errors.As(err, &schemaErr) {
+		t.Errorf("Save() error = %v, want *SchemaError", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != newer {
+		t.Errorf("file was modified: %s", data)
+	}
+}
+
+func TestReadOnlyLeavesLegacyFile(t *testing.T) {
+	useDir(t, t.TempDir())
+	stashDir, _ := Dir()
+	os.MkdirAll(stashDir, 0755)
+	path := filepath.Join(stashDir, "commands.json")
+	legacy := `[{"text": "echo hello", "created_at": "2024-01-02T03:04:05Z", "use_count": 3}]`
+	os.WriteFile(path, []byte(legacy), 0644)
+
+	for _, kind := range []string{KindJSON, KindBolt} {
+		store, err := OpenReadOnly(kind, DefaultStash)
+		if err != nil {
+			t.Fatalf("OpenReadOnly(%s) error = %v", kind, err)
+		}
+		if commands, err := store.Load(); err != nil || len(commands) != 1 {
+			t.Errorf("OpenReadOnly(%s).Load() = %v, %v, want the legacy command", kind, commands, err)
+		}
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != legacy {
+		t.Errorf("read-only loads changed the file: %s", data)
+	}
+	entries, _ := os.ReadDir(stashDir)
+	if len(entries) != 1 {
+		t.Errorf("read-only loads left files behind: %v", entries)
+	}
+
+	// Opening it for writing upgrades it once
+	if _, err := Open(KindJSON, DefaultStash); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, err := os.Stat(path + ".v1.bak"); err != nil {
+		t.Errorf("Open() did not upgrade the file: %v", err)
+	}
+}
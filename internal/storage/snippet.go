@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// snippetDelimiter opens and closes the front matter of a snippet
+const snippetDelimiter = "---"
+
+// ErrEmptyText is returned when saving a command without text
+var ErrEmptyText = errors.New("the command is empty")
+
+// FormatSnippet renders a command for editing in a text editor: its
+// description and tags as front matter, followed by the command itself
+func FormatSnippet(cmd Command) string {
+	var b strings.Builder
+	b.WriteString(snippetDelimiter + "\n")
+	if cmd.ID != "" {
+		fmt.Fprintf(&b, "# cli-stash %s: edit the description, tags and the command below the front matter\n", cmd.ID)
+	}
+	fmt.Fprintf(&b, "description: %s\n", escapeField(cmd.Description))
+	fmt.Fprintf(&b, "tags: %s\n", strings.Join(cmd.Tags, ", "))
+	b.WriteString(snippetDelimiter + "\n")
+	b.WriteString(cmd.Text + "\n")
+	return b.String()
+}
+
+// ParseSnippet reads back a snippet written by FormatSnippet. Lines starting
+// with # in the front matter are comments. The command keeps its line
+// breaks but loses trailing white space. Errors name the offending line.
+func ParseSnippet(data string) (Command, error) {
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	if start == len(lines) || strings.TrimSpace(lines[start]) != snippetDelimiter {
+		return Command{}, fmt.Errorf("line %d: the front matter must start with %s", start+1, snippetDelimiter)
+	}
+
+	var cmd Command
+	for i := start + 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == snippetDelimiter:
+			cmd.Text = NormalizeText(strings.Join(lines[i+1:], "\n"))
+			return cmd, nil
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return Command{}, fmt.Errorf("line %d: want \"name: value\", got %q", i+1, line)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(name) {
+		case "description":
+			cmd.Description = unescapeField(value)
+		case "tags":
+			cmd.Tags = ParseTags(value)
+		default:
+			return Command{}, fmt.Errorf("line %d: unknown field %q (want description or tags)", i+1, strings.TrimSpace(name))
+		}
+	}
+	last := len(lines)
+	if last > 1 && lines[last-1] == "" {
+		last-- // the final line break
+	}
+	return Command{}, fmt.Errorf("line %d: the front matter is not closed with %s", last, snippetDelimiter)
+}
+
+// escapeField keeps a front matter value on one line, writing line breaks
+// as \n and backslashes as \\
+func escapeField(value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(value)
+}
+
+// unescapeField undoes escapeField. Other backslashes are kept as typed.
+func unescapeField(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			switch value[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+				i++
+				continue
+			case '\\':
+				b.WriteByte('\\')
+				i++
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// NormalizeText drops the CRLF line endings, trailing white space and
+// leading blank lines that editors, pipes and shell quoting leave around a
+// command, so the same command is always saved with the same text
+func NormalizeText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.TrimLeft(strings.TrimRight(text, " \t\n"), "\n")
+}
+
+// upserter is implemented by backends that can save a single command
+// without rewriting the others
+type upserter interface {
+	Upsert(cmd Command) (Command, bool, error)
+}
+
+// Save adds cmd.Text to b with its tags and description. If the text is
+// already saved, the tags are added to those it has and a non-empty
+// description replaces its own. It reports whether the command is new.
+// The lookup and the change run in one transaction, so concurrent saves
+// and uses are not lost.
+func Save(b Backend, cmd Command) (Command, bool, error) {
+	if u, ok := b.(upserter); ok {
+		return u.Upsert(cmd)
+	}
+
+	var saved Command
+	isNew := false
+	err := b.Transaction(func(commands []Command) ([]Command, error) {
+		for i, c := range commands {
+			if c.Text == cmd.Text {
+				mergeSaved(&commands[i], cmd)
+				saved = commands[i]
+				return commands, nil
+			}
+		}
+
+		isNew = true
+		saved = newSaved(cmd, newID(commands))
+		return append(commands, saved), nil
+	})
+	if err != nil {
+		return Command{}, false, err
+	}
+	return saved, isNew, nil
+}
+
+// newSaved returns cmd as a new command with the given ID
+func newSaved(cmd Command, id string) Command {
+	return Command{
+		ID:          id,
+		Text:        cmd.Text,
+		Tags:        NormalizeTags(cmd.Tags),
+		Description: cmd.Description,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// mergeSaved adds the tags of cmd to existing and replaces its description
+// with a non-empty one of cmd
+func mergeSaved(existing *Command, cmd Command) {
+	existing.Tags = NormalizeTags(append(existing.Tags, cmd.Tags...))
+	if cmd.Description != "" {
+		existing.Description = cmd.Description
+	}
+}
+
+// CheckText reports why text can't be saved as the command with the given
+// ID: it is empty, or another personal command already has the same text
+func CheckText(commands []Command, id, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return ErrEmptyText
+	}
+	for _, cmd := range commands {
+		if cmd.Text == text && cmd.ID != id && cmd.Origin == "" {
+			return duplicateError(cmd.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Stash names with a special meaning
+const (
+	// DefaultStash lives directly in the stash directory, where cli-stash
+	// kept its only stash before named stashes existed
+	DefaultStash = "default"
+	// AllStashes opens every stash at once
+	AllStashes = "all"
+)
+
+// ErrAllStashes is returned when adding a command to the view of all
+// stashes, which can't tell where it should go
+var ErrAllStashes = fmt.Errorf("new commands need a named stash, not %q", AllStashes)
+
+// stashNamePattern keeps stash names usable as file names
+var stashNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ValidateStashName checks that name can be used for a new stash
+func ValidateStashName(name string) error {
+	if name == DefaultStash || name == AllStashes {
+		return fmt.Errorf("stash name %q is reserved", name)
+	}
+	if !stashNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid stash name %q (use letters, digits, - and _)", name)
+	}
+	return nil
+}
+
+// stashFiles returns the JSON and bolt file paths of a stash
+func stashFiles(name string) (jsonPath, boltPath string, err error) {
+	stashDir, err := Dir()
+	if err != nil {
+		return "", "", err
+	}
+
+	base := filepath.Join(stashDir, "commands")
+	if name != DefaultStash {
+		base = filepath.Join(stashDir, "stashes", name)
+	}
+	return base + ".json", base + ".db", nil
+}
+
+// stashExists reports whether a stash was created with either backend
+func stashExists(name string) (bool, error) {
+	if name == DefaultStash {
+		return true, nil
+	}
+	jsonPath, boltPath, err := stashFiles(name)
+	if err != nil {
+		return false, err
+	}
+	for _, path := range []string{jsonPath, boltPath} {
+		if _, err := os.Stat(path); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Open returns the backend of the given kind for the named stash. An empty
+// name selects the default stash and AllStashes combines every stash. The
+// first time the bolt backend is opened, an existing JSON file of the same
+// stash is imported into it.
+func Open(kind, name string) (Backend, error) {
+	if name == "" {
+		name = DefaultStash
+	}
+	if name == AllStashes {
+		return openAll(kind)
+	}
+	if err := checkStash(name); err != nil {
+		return nil, err
+	}
+	return openStash(kind, name)
+}
+
+// OpenReadOnly returns a read-only view of the named stash that, unlike
+// Open, doesn't create a bolt database: a bolt stash that has none yet
+// shows the JSON file it would import
+func OpenReadOnly(kind, name string) (Backend, error) {
+	if name == "" {
+		name = DefaultStash
+	}
+	if err := checkStash(name); err != nil {
+		return nil, err
+	}
+	jsonPath, boltPath, err := stashFiles(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "", KindJSON:
+		return ReadOnly(jsonView(jsonPath)), nil
+	case KindBolt:
+		if _, err := os.Stat(boltPath); os.IsNotExist(err) {
+			return ReadOnly(jsonView(jsonPath)), nil
+		}
+		return ReadOnly(NewBolt(boltPath)), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (want %s or %s)", kind, KindJSON, KindBolt)
+	}
+}
+
+// checkStash fails unless name is the default stash or a valid stash that
+// exists
+func checkStash(name string) error {
+	if name == DefaultStash {
+		return nil
+	}
+	if err := ValidateStashName(name); err != nil {
+		return err
+	}
+	if ok, err := stashExists(name); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("stash %q does not exist (create it with: cli-stash stashes create %s)", name, name)
+	}
+	return nil
+}
+
+func openStash(kind, name string) (Backend, error) {
+	jsonPath, boltPath, err := stashFiles(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "", KindJSON:
+		store := NewAt(jsonPath)
+		if err := store.Upgrade(); err != nil {
+			return nil, err
+		}
+		return store, nil
+	case KindBolt:
+		store := NewBolt(boltPath)
+		if err := store.ImportJSON(jsonPath); err != nil {
+			return nil, fmt.Errorf("importing %s: %w", filepath.Base(jsonPath), err)
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (want %s or %s)", kind, KindJSON, KindBolt)
+	}
+}
+
+// openAll combines every stash into one Multi backend
+func openAll(kind string) (Backend, error) {
+	names, err := Stashes()
+	if err != nil {
+		return nil, err
+	}
+
+	stores := make([]Backend, len(names))
+	for i, name := range names {
+		if stores[i], err = openStash(kind, name); err != nil {
+			return nil, err
+		}
+	}
+	return &Multi{names: names, stores: stores}, nil
+}
+
+// Stashes returns the names of all stashes, the default stash first
+func Stashes() ([]string, error) {
+	stashDir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(stashDir, "stashes"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if entry.IsDir() || ext != ".json" && ext != ".db" || ValidateStashName(name) != nil || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return append([]string{DefaultStash}, names...), nil
+}
+
+// CreateStash creates an empty stash for the given backend kind
+func CreateStash(kind, name string) error {
+	if err := ValidateStashName(name); err != nil {
+		return err
+	}
+	if ok, err := stashExists(name); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("stash %q already exists", name)
+	}
+
+	jsonPath, _, err := stashFiles(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(jsonPath), 0755); err != nil {
+		return err
+	}
+
+	store, err := openStash(kind, name)
+	if err != nil {
+		return err
+	}
+	// An empty transaction writes the file or database
+	return store.Transaction(func(commands []Command) ([]Command, error) {
+		return commands, nil
+	})
+}
+
+// DeleteStash removes a named stash with all its files. The default stash
+// can't be deleted.
+func DeleteStash(name string) error {
+	if name == DefaultStash {
+		return errors.New("the default stash can't be deleted")
+	}
+	if err := ValidateStashName(name); err != nil {
+		return err
+	}
+	if ok, err := stashExists(name); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("stash %q does not exist", name)
+	}
+
+	jsonPath, boltPath, err := stashFiles(name)
+	if err != nil {
+		return err
+	}
+	backups, _ := filepath.Glob(jsonPath + ".v*.bak")
+	for _, path := range append([]string{jsonPath, jsonPath + ".lock", boltPath}, backups...) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Multi combines several stashes. Every command carries the name of its
+// stash and changes go to the stash owning the command. New commands are
+// refused with ErrAllStashes.
+type Multi struct {
+	names  []string
+	stores []Backend
+}
+
+// Load returns the commands of every stash, in stash order
+func (m *Multi) Load() ([]Command, error) {
+	var commands []Command
+	for i, store := range m.stores {
+		stashCommands, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		for _, cmd := range stashCommands {
+			cmd.Stash = m.names[i]
+			commands = append(commands, cmd)
+		}
+	}
+	return commands, nil
+}
+
+// List returns all commands sorted by frecency (most relevant first),
+// boosting those used in the current directory or repository
+func (m *Multi) List() ([]Command, error) {
+	commands, err := m.Load()
+	if err != nil {
+		return nil, err
+	}
+	Sort(commands, SortFrecency, CurrentPlace())
+	return commands, nil
+}
+
+// Add fails with ErrAllStashes
+func (m *Multi) Add(string) (Command, error) {
+	return Command{}, ErrAllStashes
+}
+
+// Remove deletes a command from the stash owning it
+func (m *Multi) Remove(id string) error {
+	store, err := m.owner(id)
+	if err != nil || store == nil {
+		return err
+	}
+	return store.Remove(id)
+}
+
+// Update edits a command in the stash owning it
+func (m *Multi) Update(cmd Command) error {
+	store, err := m.owner(cmd.ID)
+	if err != nil || store == nil {
+		return err
+	}
+	return store.Update(cmd)
+}
+
+// IncrementUse records a use in the stash owning the command
+func (m *Multi) IncrementUse(id string, place Place) error {
+	store, err := m.owner(id)
+	if err != nil || store == nil {
+		return err
+	}
+	return store.IncrementUse(id, place)
+}
+
+// Transaction fails with ErrAllStashes, since its result could add
+// commands without saying to which stash
+func (m *Multi) Transaction(func(commands []Command) ([]Command, error)) error {
+	return ErrAllStashes
+}
+
+// owner returns the stash holding the command with id, or nil
+func (m *Multi) owner(id string) (Backend, error) {
+	for _, store := range m.stores {
+		commands, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		for _, cmd := range commands {
+			if cmd.ID == id {
+				return store, nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStashes(t *testing.T) {
+	useDir(t, t.TempDir())
+
+	t.Run("Default", func(t *testing.T) {
+		names, err := Stashes()
+		if err != nil || !reflect.DeepEqual(names, []string{DefaultStash}) {
+			t.Errorf("Stashes() = %v, %v; want [default]", names, err)
+		}
+		if _, err := Open(KindJSON, ""); err != nil {
+			t.Errorf("Open(default) error = %v", err)
+		}
+		if _, err := Open(KindJSON, "work"); err == nil {
+			t.Error("Open() of a missing stash should fail")
+		}
+	})
+
+	t.Run("CreateAndDelete", func(t *testing.T) {
+		for _, name := range []string{"work", "oncall"} {
+			if err := CreateStash(KindJSON, name); err != nil {
+				t.Fatalf("CreateStash(%s) error = %v", name, err)
+			}
+		}
+		if err := CreateStash(KindJSON, "work"); err == nil {
+			t.Error("CreateStash() of an existing stash should fail")
+		}
+		for _, name := range []string{AllStashes, DefaultStash, "../evil", ""} {
+			if err := CreateStash(KindJSON, name); err == nil {
+				t.Errorf("CreateStash(%q) should fail", name)
+			}
+		}
+		if err := ValidateStashName(DefaultStash); err == nil {
+			t.Error("ValidateStashName(default) should fail")
+		}
+		if err := CreateStash(KindBolt, "bolted"); err != nil {
+			t.Fatalf("CreateStash(bolt) error = %v", err)
+		}
+
+		// Stray files with reserved names are not stashes
+		stashDir, _ := Dir()
+		for _, name := range []string{"default.json", "all.json", "all.db"} {
+			os.WriteFile(filepath.Join(stashDir, "stashes", name), nil, 0644)
+		}
+
+		names, _ := Stashes()
+		if want := []string{DefaultStash, "bolted", "oncall", "work"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Stashes() = %v, want %v", names, want)
+		}
+
+		if err := DeleteStash("bolted"); err != nil {
+			t.Errorf("DeleteStash() error = %v", err)
+		}
+		if err := DeleteStash(DefaultStash); err == nil {
+			t.Error("DeleteStash(default) should fail")
+		}
+		if err := DeleteStash("missing"); err == nil {
+			t.Error("DeleteStash() of a missing stash should fail")
+		}
+	})
+
+	t.Run("Separate", func(t *testing.T) {
+		work, _ := Open(KindJSON, "work")
+		work.Add("kubectl get pods")
+		personal, _ := Open(KindJSON, DefaultStash)
+		personal.Add("git status")
+
+		commands, _ := work.Load()
+		if len(commands) != 1 || commands[0].Text != "kubectl get pods" {
+			t.Errorf("work stash = %v, want [kubectl get pods]", commands)
+		}
+		stashDir, _ := Dir()
+		if path := work.(*JSONStore).path; path != filepath.Join(stashDir, "stashes", "work.json") {
+			t.Errorf("work stash path = %s", path)
+		}
+
+		// Reading a bolt stash doesn't import the JSON file into a new database
+		view, err := OpenReadOnly(KindBolt, "work")
+		if err != nil {
+			t.Fatalf("OpenReadOnly() error = %v", err)
+		}
+		if commands, _ := view.Load(); len(commands) != 1 {
+			t.Errorf("OpenReadOnly() commands = %v, want the JSON ones", commands)
+		}
+		if _, err := os.Stat(filepath.Join(stashDir, "stashes", "work.db")); !os.IsNotExist(err) {
+			t.Errorf("OpenReadOnly() created a database: %v", err)
+		}
+		if _, err := view.Add("ls"); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Add() error = %v, want ErrReadOnly", err)
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		all, err := Open(KindJSON, AllStashes)
+		if err != nil {
+			t.Fatalf("Open(all) error = %v", err)
+		}
+		commands, _ := all.Load()
+		bySource := make(map[string]Command)
+		for _, cmd := range commands {
+			bySource[cmd.Stash] = cmd
+		}
+		if bySource["work"].Text != "kubectl get pods" || bySource[DefaultStash].Text != "git status" {
+			t.Fatalf("Open(all) commands = %+v, want one per stash with its source", commands)
+		}
+
+		if _, err := all.Add("make test"); !errors.Is(err, ErrAllStashes) {
+			t.Errorf("Add() error = %v, want ErrAllStashes", err)
+		}
+		if _, _, err := Save(all, Command{Text: "make test"}); !errors.Is(err, ErrAllStashes) {
+			t.Errorf("Save() error = %v, want ErrAllStashes", err)
+		}
+
+		// Changes go to the stash owning the command
+		kubectl := bySource["work"]
+		if err := all.IncrementUse(kubectl.ID, Place{}); err != nil {
+			t.Fatalf("IncrementUse() error = %v", err)
+		}
+		if err := all.Remove(bySource[DefaultStash].ID); err != nil {
+			t.Fatalf("Remove() error = %v", err)
+		}
+
+		work, _ := Open(KindJSON, "work")
+		cmd, err := Resolve(work, kubectl.ID)
+		if err != nil || cmd.UseCount != 1 {
+			t.Errorf("work command = %+v, %v; want one use", cmd, err)
+		}
+		personal, _ := Open(KindJSON, DefaultStash)
+		if commands, _ := personal.Load(); len(commands) != 0 {
+			t.Errorf("default stash = %v, want empty", commands)
+		}
+
+		if err := DeleteStash("work"); err != nil {
+			t.Errorf("DeleteStash(work) error = %v", err)
+		}
+	})
+}
@@ -1,163 +1,107 @@
 package storage
 
 import (
-	"encoding/json"
-	"os"
-	"path/filepath"
+	"errors"
+	"fmt"
 	"sort"
 	"time"
 )
 
-// Command represents a saved command with metadata
-type Command struct {
-	Text      string    `json:"text"`
-	CreatedAt time.Time `json:"created_at"`
-	UseCount  int       `json:"use_count"`
-}
-
-// Storage handles saving and loading commands
-type Storage struct {
-	path string
-}
+// Backend kinds accepted by Open
+const (
+	KindJSON = "json"
+	KindBolt = "bolt"
+)
 
-// New creates a new Storage instance
-func New() (*Storage, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
-	}
+// ErrReadOnly is returned when mutating a backend that does not accept writes
+var ErrReadOnly = errors.New("storage is read-only")
 
-	stashDir := filepath.Join(homeDir, ".stash")
-	if err := os.MkdirAll(stashDir, 0755); err != nil {
-		return nil, err
-	}
+// ErrDuplicate is returned when an update would give a command the text of
+// another one
+var ErrDuplicate = errors.New("the same command is already saved")
 
-	return &Storage{
-		path: filepath.Join(stashDir, "commands.json"),
-	}, nil
+// duplicateError reports that the command id already has the text
+func duplicateError(id string) error {
+	return fmt.Errorf("%w as %s", ErrDuplicate, id)
 }
 
-// Load reads all commands from storage
-func (s *Storage) Load() ([]Command, error) {
-	data, err := os.ReadFile(s.path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []Command{}, nil
-		}
-		return nil, err
-	}
-
-	var commands []Command
-	if err := json.Unmarshal(data, &commands); err != nil {
-		return nil, err
-	}
-
-	return commands, nil
+// Command represents a saved command with metadata
+type Command struct {
+	ID          string    `json:"id"`
+	Text        string    `json:"text"`
+	Tags        []string  `json:"tags,omitempty"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UseCount    int       `json:"use_count"`
+	// LastUsedAt and Uses record when the command was selected, most
+	// recent last, for frecency ranking
+	LastUsedAt time.Time   `json:"last_used_at,omitzero"`
+	Uses       []time.Time `json:"uses,omitempty"`
+	// Dirs and Repos count uses per working directory and git repository root
+	Dirs  map[string]int `json:"dirs,omitempty"`
+	Repos map[string]int `json:"repos,omitempty"`
+	// Origin is the project stash file a read-only command comes from,
+	// empty for personal commands. It is never stored.
+	Origin string `json:"-"`
+	// Stash names the stash a command comes from when several are shown
+	// together. It is never stored.
+	Stash string `json:"-"`
 }
 
-// Save writes all commands to storage
-func (s *Storage) Save(commands []Command) error {
-	data, err := json.MarshalIndent(commands, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(s.path, data, 0644)
+// Backend is the interface implemented by every command store
+type Backend interface {
+	// Load returns all commands in storage order
+	Load() ([]Command, error)
+	// Add appends a new command and returns it. If the text is already
+	// saved, the existing command is returned instead.
+	Add(text string) (Command, error)
+	// Remove deletes the command with the given ID
+	Remove(id string) error
+	// Update replaces the editable fields (text, tags, description) of the command
+	// with the same ID, preserving metadata. Text saved as another command
+	// is refused with ErrDuplicate.
+	Update(cmd Command) error
+	// IncrementUse records a use of the command with the given ID at place
+	IncrementUse(id string, place Place) error
+	// List returns all commands sorted by frecency (most relevant first),
+	// boosting those used in the current directory or repository
+	List() ([]Command, error)
+	// Transaction runs fn as a single read-modify-write cycle.
+	// The commands returned by fn replace the stored ones.
+	Transaction(fn func(commands []Command) ([]Command, error)) error
 }
 
-// Add appends a new command to storage
-func (s *Storage) Add(text string) error {
-	commands, err := s.Load()
-	if err != nil {
-		return err
-	}
-
-	// Check if command already exists
-	for _, cmd := range commands {
-		if cmd.Text == text {
-			return nil // Already exists, skip
+// sortByUsage sorts commands by use count (descending), then by date (newest first)
+func sortByUsage(commands []Command) {
+	sort.Slice(commands, func(i, j int) bool {
+		if commands[i].UseCount != commands[j].UseCount {
+			return commands[i].UseCount > commands[j].UseCount
 		}
-	}
-
-	commands = append(commands, Command{
-		Text:      text,
-		CreatedAt: time.Now(),
-		UseCount:  0,
+		return commands[i].CreatedAt.After(commands[j].CreatedAt)
 	})
-
-	return s.Save(commands)
 }
 
-// Remove deletes a command from storage
-func (s *Storage) Remove(text string) error {
-	commands, err := s.Load()
-	if err != nil {
-		return err
-	}
-
-	filtered := make([]Command, 0, len(commands))
-	for _, cmd := range commands {
-		if cmd.Text != text {
-			filtered = append(filtered, cmd)
-		}
-	}
-
-	return s.Save(filtered)
+// reader is the read half of Backend
+type reader interface {
+	Load() ([]Command, error)
+	List() ([]Command, error)
 }
 
-// Update replaces old command text with new text, preserving metadata
-func (s *Storage) Update(oldText, newText string) error {
-	commands, err := s.Load()
-	if err != nil {
-		return err
-	}
-
-	for i, cmd := range commands {
-		if cmd.Text == oldText {
-			commands[i].Text = newText
-			break
-		}
-	}
-
-	return s.Save(commands)
+// readOnly turns a reader into a Backend that rejects all mutations
+type readOnly struct {
+	reader
 }
 
-// IncrementUse increases the use count for a command
-func (s *Storage) IncrementUse(text string) error {
-	commands, err := s.Load()
-	if err != nil {
-		return err
-	}
-
-	for i, cmd := range commands {
-		if cmd.Text == text {
-			commands[i].UseCount++
-			break
-		}
-	}
-
-	return s.Save(commands)
+// ReadOnly returns a view of b that fails every mutation with ErrReadOnly
+func ReadOnly(b Backend) Backend {
+	return readOnly{reader: b}
 }
 
-// List returns all command texts sorted by usage (most used first)
-func (s *Storage) List() ([]string, error) {
-	commands, err := s.Load()
-	if err != nil {
-		return nil, err
-	}
-
-	// Sort by use count (descending), then by date (newest first)
-	sort.Slice(commands, func(i, j int) bool {
-		if commands[i].UseCount != commands[j].UseCount {
-			return commands[i].UseCount > commands[j].UseCount
-		}
-		return commands[i].CreatedAt.After(commands[j].CreatedAt)
-	})
-
-	texts := make([]string, len(commands))
-	for i, cmd := range commands {
-		texts[i] = cmd.Text
-	}
+func (readOnly) Add(string) (Command, error)      { return Command{}, ErrReadOnly }
+func (readOnly) Remove(string) error              { return ErrReadOnly }
+func (readOnly) Update(Command) error             { return ErrReadOnly }
+func (readOnly) IncrementUse(string, Place) error { return ErrReadOnly }
 
-	return texts, nil
+func (readOnly) Transaction(func([]Command) ([]Command, error)) error {
+	return ErrReadOnly
 }
@@ -1,9 +1,16 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestStorageOperations(t *testing.T) {
@@ -15,7 +22,7 @@ func TestStorageOperations(t *testing.T) {
 	defer os.RemoveAll(tmpDir)
 
 	// Create storage with custom path
-	store := &Storage{
+	store := &JSONStore{
 		path: filepath.Join(tmpDir, "commands.json"),
 	}
 
@@ -31,11 +38,16 @@ func TestStorageOperations(t *testing.T) {
 	})
 
 	// Test Add
+	var helloID string
 	t.Run("Add", func(t *testing.T) {
-		err := store.Add("echo hello")
+		cmd, err := store.Add("echo hello")
 		if err != nil {
 			t.Errorf("Add() error = %v", err)
 		}
+		if cmd.ID == "" {
+			t.Error("Add() returned command without ID")
+		}
+		helloID = cmd.ID
 
 		commands, err := store.Load()
 		if err != nil {
@@ -51,10 +63,13 @@ func TestStorageOperations(t *testing.T) {
 
 	// Test Add duplicate (should skip)
 	t.Run("AddDuplicate", func(t *testing.T) {
-		err := store.Add("echo hello")
+		cmd, err := store.Add("echo hello")
 		if err != nil {
 			t.Errorf("Add() error = %v", err)
 		}
+		if cmd.ID != helloID {
+			t.Errorf("Add() duplicate ID = %q, want existing %q", cmd.ID, helloID)
+		}
 
 		commands, err := store.Load()
 		if err != nil {
@@ -67,7 +82,7 @@ func TestStorageOperations(t *testing.T) {
 
 	// Test Add second command
 	t.Run("AddSecond", func(t *testing.T) {
-		err := store.Add("ls -la")
+		_, err := store.Add("ls -la")
 		if err != nil {
 			t.Errorf("Add() error = %v", err)
 		}
@@ -83,18 +98,33 @@ func TestStorageOperations(t *testing.T) {
 
 	// Test List
 	t.Run("List", func(t *testing.T) {
-		texts, err := store.List()
+		commands, err := store.List()
 		if err != nil {
 			t.Errorf("List() error = %v", err)
 		}
-		if len(texts) != 2 {
-			t.Errorf("List() len = %d, want 2", len(texts))
+		if len(commands) != 2 {
+			t.Errorf("List() len = %d, want 2", len(commands))
+		}
+	})
+
+	// Test Update keeps the ID
+	t.Run("Update", func(t *testing.T) {
+		if err := store.Update(Command{ID: helloID, Text: "echo hello "}); err != nil {
+			t.Errorf("Update() error = %v", err)
+		}
+
+		cmd, err := Resolve(store, helloID)
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if cmd.Text != "echo hello " {
+			t.Errorf("Resolve().Text = %q, want %q", cmd.Text, "echo hello ")
 		}
 	})
 
 	// Test Remove
 	t.Run("Remove", func(t *testing.T) {
-		err := store.Remove("echo hello")
+		err := store.Remove(helloID)
 		if err != nil {
 			t.Errorf("Remove() error = %v", err)
 		}
@@ -113,6 +143,8 @@ func TestStorageOperations(t *testing.T) {
 }
 
 func TestNew(t *testing.T) {
+	useDir(t, t.TempDir())
+
 	store, err := New()
 	if err != nil {
 		t.Fatalf("New() error = %v", err)
@@ -126,8 +158,406 @@ func TestNew(t *testing.T) {
 		t.Error("New() path is empty")
 	}
 
-	// Verify path contains .stash
+	// Verify path is absolute
 	if !filepath.IsAbs(store.path) {
 		t.Errorf("New() path is not absolute: %s", store.path)
 	}
 }
+
+func TestReadOnly(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "stash-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inner := &JSONStore{path: filepath.Join(tmpDir, "commands.json")}
+	shared, err := inner.Add("echo shared")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	store := ReadOnly(inner)
+
+	if _, err := store.Add("echo new"); err != ErrReadOnly {
+		t.Errorf("Add() error = %v, want ErrReadOnly", err)
+	}
+	if err := store.Remove(shared.ID); err != ErrReadOnly {
+		t.Errorf("Remove() error = %v, want ErrReadOnly", err)
+	}
+
+	commands, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(commands) != 1 || commands[0].Text != "echo shared" {
+		t.Errorf("List() = %v, want [echo shared]", commands)
+	}
+}
+
+func TestFind(t *testing.T) {
+	commands := []Command{
+		{ID: "3f2a9c1b", Text: "git status"},
+		{ID: "3f2b0000", Text: "ls -la"},
+		{ID: "a0b1c2d3", Text: "make test"},
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{"3f2a9c1b", "git status", false},
+		{"3f2a", "git status", false},
+		{"A0B", "make test", false},
+		{"3f2", "", true}, // ambiguous
+		{"ffff", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			cmd, err := Find(commands, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Find(%q) error = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			}
+			if cmd.Text != tt.want {
+				t.Errorf("Find(%q) = %q, want %q", tt.ref, cmd.Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	t.Run("ParseTags", func(t *testing.T) {
+		got := ParseTags("K8s, #logs  k8s,,prod")
+		want := []string{"k8s", "logs", "prod"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("ParseTags() = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("UpdateAndByTag", func(t *testing.T) {
+		store := &JSONStore{path: filepath.Join(t.TempDir(), "commands.json")}
+		logs, _ := store.Add("kubectl logs -f")
+		store.Add("terraform plan")
+
+		if err := store.Update(Command{ID: logs.ID, Text: logs.Text, Tags: []string{"K8s"}}); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+
+		commands, err := ByTag(store, "#k8s")
+		if err != nil {
+			t.Fatalf("ByTag() error = %v", err)
+		}
+		if len(commands) != 1 || commands[0].ID != logs.ID {
+			t.Errorf("ByTag(k8s) = %v, want [kubectl logs -f]", commands)
+		}
+		if !commands[0].HasTag("k8s") {
+			t.Error("HasTag(k8s) = false, want true")
+		}
+	})
+}
+
+func TestValueStore(t *testing.T) {
+	values := NewValueStore(filepath.Join(t.TempDir(), "placeholders.json"))
+
+	if got := values.Values("ns"); len(got) != 0 {
+		t.Errorf("Values() on empty store = %v, want none", got)
+	}
+
+	values.Remember(map[string]string{"ns": "dev"})
+	values.Remember(map[string]string{"ns": "prod", "pod": "web"})
+	values.Remember(map[string]string{"ns": "dev", "empty": ""})
+
+	if got := strings.Join(values.Values("ns"), ","); got != "dev,prod" {
+		t.Errorf("Values(ns) = %s, want dev,prod (most recent first, no duplicates)", got)
+	}
+	if got := values.Values("pod"); len(got) != 1 || got[0] != "web" {
+		t.Errorf("Values(pod) = %v, want [web]", got)
+	}
+	if got := values.Values("empty"); len(got) != 0 {
+		t.Errorf("Values(empty) = %v, want none", got)
+	}
+}
+
+func TestFrecency(t *testing.T) {
+	now := time.Now()
+	yearAgo := now.AddDate(-1, 0, 0)
+
+	// Used 50 times last year, before use times were recorded
+	old := Command{ID: "old", Text: "svn update", CreatedAt: yearAgo, UseCount: 50}
+	daily := Command{ID: "daily", Text: "git pull", CreatedAt: yearAgo}
+	for i := 0; i < 10; i++ {
+		recordUse(&daily, now.Add(-time.Duration(i)*12*time.Hour), Place{})
+	}
+	fresh := Command{ID: "fresh", Text: "make test", CreatedAt: now}
+
+	if got, want := old.Frecency(now), 5.0; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Frecency() = %v, want %v", got, want)
+	}
+	if old.Frecency(now) >= daily.Frecency(now) {
+		t.Errorf("Frecency() old = %v, daily = %v; want daily higher", old.Frecency(now), daily.Frecency(now))
+	}
+
+	tests := []struct {
+		order SortOrder
+		want  []string
+	}{
+		{SortFrecency, []string{"daily", "old", "fresh"}},
+		{SortCount, []string{"old", "daily", "fresh"}},
+		{SortRecent, []string{"daily", "fresh", "old"}},
+		{SortAlpha, []string{"daily", "fresh", "old"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			commands := []Command{fresh, old, daily}
+			Sort(commands, tt.order, Place{})
+			var got []string
+			for _, cmd := range commands {
+				got = append(got, cmd.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Sort(%s) = %v, want %v", tt.order, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("UseHistoryCap", func(t *testing.T) {
+		cmd := Command{}
+		for i := 0; i < maxUseHistory+5; i++ {
+			recordUse(&cmd, now, Place{})
+		}
+		if len(cmd.Uses) != maxUseHistory || cmd.UseCount != maxUseHistory+5 {
+			t.Errorf("recordUse() kept %d uses, count %d", len(cmd.Uses), cmd.UseCount)
+		}
+		if !cmd.LastUsedAt.Equal(now) {
+			t.Errorf("recordUse() LastUsedAt = %v, want %v", cmd.LastUsedAt, now)
+		}
+	})
+
+	t.Run("ParseSortOrder", func(t *testing.T) {
+		if order, err := ParseSortOrder(""); err != nil || order != SortFrecency {
+			t.Errorf("ParseSortOrder(\"\") = %v, %v; want frecency", order, err)
+		}
+		if _, err := ParseSortOrder("random"); err == nil {
+			t.Error("ParseSortOrder(\"random\") should fail")
+		}
+		if SortAlpha.Next() != SortFrecency {
+			t.Errorf("SortAlpha.Next() = %v, want frecency", SortAlpha.Next())
+		}
+	})
+}
+
+func TestPlaces(t *testing.T) {
+	tmpDir := t.TempDir()
+	repo := filepath.Join(tmpDir, "infra")
+	sub := filepath.Join(repo, "modules", "vpc")
+	os.MkdirAll(sub, 0755)
+	os.Mkdir(filepath.Join(repo, ".git"), 0755)
+
+	t.Run("PlaceOf", func(t *testing.T) {
+		if got, want := PlaceOf(sub), (Place{Dir: sub, Repo: repo}); got != want {
+			t.Errorf("PlaceOf(sub) = %+v, want %+v", got, want)
+		}
+		if got := PlaceOf(tmpDir); got.Repo != "" {
+			t.Errorf("PlaceOf(outside) Repo = %q, want none", got.Repo)
+		}
+	})
+
+	t.Run("IncrementUse", func(t *testing.T) {
+		store := &JSONStore{path: filepath.Join(tmpDir, "commands.json")}
+		tf, _ := store.Add("terraform plan")
+		kc, _ := store.Add("kubectl get pods")
+
+		here := PlaceOf(sub)
+		store.IncrementUse(tf.ID, here)
+		store.IncrementUse(tf.ID, here)
+		store.IncrementUse(kc.ID, PlaceOf(tmpDir))
+		store.IncrementUse(kc.ID, PlaceOf(tmpDir))
+		store.IncrementUse(kc.ID, PlaceOf(tmpDir))
+
+		tf, _ = Resolve(store, tf.ID)
+		if tf.Dirs[sub] != 2 || tf.Repos[repo] != 2 {
+			t.Errorf("IncrementUse() Dirs = %v, Repos = %v; want 2 uses each", tf.Dirs, tf.Repos)
+		}
+
+		commands, _ := store.Load()
+		Sort(commands, SortFrecency, Place{})
+		if commands[0].ID != kc.ID {
+			t.Errorf("Sort() without place = %v first, want kubectl", commands[0].Text)
+		}
+		Sort(commands, SortFrecency, here)
+		if commands[0].ID != tf.ID {
+			t.Errorf("Sort() in repo = %v first, want terraform", commands[0].Text)
+		}
+		Sort(commands, SortFrecency, PlaceOf(repo))
+		if commands[0].ID != tf.ID {
+			t.Errorf("Sort() elsewhere in repo = %v first, want terraform", commands[0].Text)
+		}
+	})
+
+	t.Run("Cap", func(t *testing.T) {
+		var cmd Command
+		for i := 0; i < maxPlaces+10; i++ {
+			recordPlace(&cmd, Place{Dir: filepath.Join("/tmp", strconv.Itoa(i))})
+		}
+		if len(cmd.Dirs) != maxPlaces {
+			t.Errorf("recordPlace() kept %d dirs, want %d", len(cmd.Dirs), maxPlaces)
+		}
+		if cmd.Dirs[filepath.Join("/tmp", strconv.Itoa(maxPlaces+9))] != 1 {
+			t.Error("recordPlace() should keep the newest dir")
+		}
+	})
+}
+
+func TestSnippet(t *testing.T) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		cmd := Command{
+			ID:          "1a2b3c4d",
+			Text:        "cat <<-EOF\n\thello\nEOF",
+			Tags:        []string{"demo", "k8s"},
+			Description: "Say hello: twice",
+		}
+		got, err := ParseSnippet(FormatSnippet(cmd))
+		if err != nil {
+			t.Fatalf("ParseSnippet() error = %v", err)
+		}
+		if got.Text != cmd.Text || got.Description != cmd.Description || strings.Join(got.Tags, ",") != "demo,k8s" {
+			t.Errorf("ParseSnippet(FormatSnippet()) = %+v, want %+v", got, cmd)
+		}
+	})
+
+	t.Run("MultiLineDescription", func(t *testing.T) {
+		for _, description := range []string{"first\nsecond", `C:\temp\new`, `a\n literal`} {
+			cmd := Command{Text: "ls", Description: description}
+			got, err := ParseSnippet(FormatSnippet(cmd))
+			if err != nil {
+				t.Fatalf("ParseSnippet() of description %q error = %v", description, err)
+			}
+			if got.Description != description {
+				t.Errorf("ParseSnippet(FormatSnippet()) description = %q, want %q", got.Description, description)
+			}
+		}
+		if got, _ := ParseSnippet("---\ndescription: C:\\temp\n---\nls\n"); got.Description != `C:\temp` {
+			t.Errorf("ParseSnippet() description = %q, want a typed backslash kept", got.Description)
+		}
+	})
+
+	t.Run("Edited", func(t *testing.T) {
+		got, err := ParseSnippet("\r\n---\r\n# comment\r\ntags: #Prod logs\r\n---\r\n\r\nkubectl logs -f  \r\n\r\n")
+		if err != nil {
+			t.Fatalf("ParseSnippet() error = %v", err)
+		}
+		if got.Text != "kubectl logs -f" || got.Description != "" || strings.Join(got.Tags, ",") != "logs,prod" {
+			t.Errorf("ParseSnippet() = %+v, want kubectl logs -f tagged logs, prod", got)
+		}
+	})
+
+	errorTests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"NoFrontMatter", "ls -la\n", "line 1: the front matter must start with ---"},
+		{"Unclosed", "---\ntags: a\nls\n", "line 3: want \"name: value\""},
+		{"NotClosed", "---\ntags: a\n", "line 2: the front matter is not closed"},
+		{"UnknownField", "---\n\ntag: a\n---\nls\n", `line 3: unknown field "tag"`},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSnippet(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseSnippet() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateDuplicate(t *testing.T) {
+	store := NewAt(filepath.Join(t.TempDir(), "commands.json"))
+	a, _ := store.Add("a")
+	store.Add("X")
+
+	if err := store.Update(Command{ID: a.ID, Text: "X"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Update() to the text of another command error = %v, want ErrDuplicate", err)
+	}
+	if commands, _ := store.Load(); commands[0].Text != "a" {
+		t.Errorf("Load() = %v, want a unchanged", commands)
+	}
+}
+
+func TestSave(t *testing.T) {
+	store := NewAt(filepath.Join(t.TempDir(), "commands.json"))
+
+	cmd, isNew, err := Save(store, Command{Text: "kubectl get pods", Tags: []string{"k8s"}, Description: "Pods"})
+	if err != nil || !isNew {
+		t.Fatalf("Save() = %v, %v, want a new command", isNew, err)
+	}
+
+	// Saving it again adds tags and keeps the description unless given
+	again, isNew, err := Save(store, Command{Text: "kubectl get pods", Tags: []string{"prod"}})
+	if err != nil || isNew || again.ID != cmd.ID {
+		t.Fatalf("Save() again = %s, %v, %v, want the existing %s", again.ID, isNew, err, cmd.ID)
+	}
+	commands, _ := store.Load()
+	if len(commands) != 1 || strings.Join(commands[0].Tags, ",") != "k8s,prod" || commands[0].Description != "Pods" {
+		t.Errorf("Load() = %+v, want one command tagged k8s, prod described Pods", commands)
+	}
+
+	Save(store, Command{Text: "kubectl get pods", Description: "All pods"})
+	if commands, _ := store.Load(); commands[0].Description != "All pods" {
+		t.Errorf("Description = %q, want the new one", commands[0].Description)
+	}
+
+	// Concurrent saves of the same command keep every tag
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := Save(store, Command{Text: "kubectl get pods", Tags: []string{fmt.Sprintf("t%d", i)}}); err != nil {
+				t.Errorf("Save() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if commands, _ := store.Load(); len(commands) != 1 || len(commands[0].Tags) != 10 {
+		t.Errorf("Load() after concurrent saves = %+v, want one command with 10 tags", commands)
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"ls -la ", "ls -la"},
+		{"\n\nls\r\n", "ls"},
+		{"cat <<-EOF\r\n\tx\r\nEOF\r\n", "cat <<-EOF\n\tx\nEOF"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeText(tt.in); got != tt.want {
+			t.Errorf("NormalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckText(t *testing.T) {
+	commands := []Command{
+		{ID: "aaaa1111", Text: "ls -la"},
+		{ID: "bbbb2222", Text: "make build", Origin: ".cli-stash.toml"},
+	}
+	tests := []struct {
+		id, text string
+		want     string
+	}{
+		{"aaaa1111", "ls -la", ""},
+		{"cccc3333", "make build", ""},
+		{"cccc3333", " \n", ErrEmptyText.Error()},
+		{"cccc3333", "ls -la", "already saved as aaaa1111"},
+	}
+	for _, tt := range tests {
+		err := CheckText(commands, tt.id, tt.text)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("CheckText(%q, %q) = %v, want %q", tt.id, tt.text, err, tt.want)
+		}
+	}
+}
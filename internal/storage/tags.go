@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// ParseTags splits a comma or space separated list into normalized tags
+func ParseTags(s string) []string {
+	return NormalizeTags(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}))
+}
+
+// NormalizeTags lowercases tags, strips a leading '#' and drops empty and
+// duplicate entries. The result is sorted.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// HasTag reports whether the command carries tag
+func (c Command) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimLeft(tag, "#"))
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// tagLister is implemented by backends that index tags
+type tagLister interface {
+	ByTag(tag string) ([]Command, error)
+}
+
+// ByTag returns the commands carrying tag, sorted by usage. Backends with
+// a tag index answer from it; others are filtered in memory.
+func ByTag(b Backend, tag string) ([]Command, error) {
+	if tl, ok := b.(tagLister); ok {
+		return tl.ByTag(tag)
+	}
+
+	commands, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Command
+	for _, cmd := range commands {
+		if cmd.HasTag(tag) {
+			result = append(result, cmd)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// maxRememberedValues is how many values are kept per placeholder
+const maxRememberedValues = 20
+
+// ValueStore remembers the values entered for template placeholders so
+// they can be suggested next time. Values are keyed by placeholder name
+// and shared by all commands.
+type ValueStore struct {
+	path string
+}
+
+// NewValueStore creates a ValueStore backed by the file at path
+func NewValueStore(path string) *ValueStore {
+	return &ValueStore{path: path}
+}
+
+// OpenValues returns the ValueStore kept in the stash directory
+func OpenValues() (*ValueStore, error) {
+	stashDir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return NewValueStore(filepath.Join(stashDir, "placeholders.json")), nil
+}
+
+// Values returns the remembered values for a placeholder, most recent first
+func (v *ValueStore) Values(name string) []string {
+	lock, err := lockFile(v.path, false)
+	if err != nil {
+		return nil
+	}
+	defer lock.Unlock()
+
+	return v.read()[name]
+}
+
+// Remember records entered values, moving them to the front of each
+// placeholder's list
+func (v *ValueStore) Remember(values map[string]string) error {
+	lock, err := lockFile(v.path, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	all := v.read()
+	for name, value := range values {
+		if value == "" {
+			continue
+		}
+		list := []string{value}
+		for _, old := range all[name] {
+			if old != value && len(list) < maxRememberedValues {
+				list = append(list, old)
+			}
+		}
+		all[name] = list
+	}
+
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(v.path, data, 0644)
+}
+
+// read loads all remembered values; the caller must hold the lock
+func (v *ValueStore) read() map[string][]string {
+	all := make(map[string][]string)
+	data, err := os.ReadFile(v.path)
+	if err != nil {
+		return all
+	}
+	json.Unmarshal(data, &all)
+	return all
+}
@@ -0,0 +1,227 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/itcaat/cli-stash/internal/shell"
+	"github.com/itcaat/cli-stash/internal/storage"
+)
+
+// maxEditorRows is the height the command editor grows to before it scrolls
+const maxEditorRows = 10
+
+// newCommandEditor creates the multi-line command field of the edit form
+func newCommandEditor() textarea.Model {
+	ta := textarea.New()
+	ta.Prompt = ""
+	ta.ShowLineNumbers = true
+	ta.CharLimit = 0
+	ta.MaxHeight = 999 // also sets the width of the line numbers
+	ta.SetWidth(120)
+	ta.SetHeight(1)
+
+	ta.FocusedStyle = textarea.Style{
+		Base:             lipgloss.NewStyle(),
+		CursorLine:       lipgloss.NewStyle(),
+		CursorLineNumber: normalStyle,
+		EndOfBuffer:      dimStyle,
+		LineNumber:       dimStyle,
+		Placeholder:      dimStyle,
+		Prompt:           dimStyle,
+		Text:             normalStyle,
+	}
+	ta.BlurredStyle = ta.FocusedStyle
+	ta.BlurredStyle.CursorLineNumber = dimStyle
+	return ta
+}
+
+// setEditorText loads text into the command editor with the cursor at the end
+func (m *PopModel) setEditorText(text string) {
+	m.cmdInput.SetValue(text)
+	m.editSource = text
+	m.editLoaded = m.cmdInput.Value()
+	m.cmdInput.SetHeight(min(m.cmdInput.LineCount(), maxEditorRows))
+}
+
+// growEditor makes room for a new line in the command editor, up to
+// maxEditorRows. It never shrinks, since the editor keeps its scroll
+// position.
+func (m *PopModel) growEditor() {
+	if h := m.cmdInput.Height(); h < maxEditorRows && m.cmdInput.LineCount() >= h {
+		m.cmdInput.SetHeight(h + 1)
+	}
+}
+
+// editorTab is what the editor turns tabs into
+const editorTab = "    "
+
+// editorText returns the command being edited. The editor turns tabs into
+// spaces, which would break <<- here-documents, so lines left untouched
+// keep the tabs they were loaded with.
+func (m PopModel) editorText() string {
+	text := m.cmdInput.Value()
+	if text == m.editLoaded {
+		return m.editSource
+	}
+
+	tabbed := make(map[string]string)
+	for _, line := range strings.Split(m.editSource, "\n") {
+		if strings.Contains(line, "\t") {
+			tabbed[strings.ReplaceAll(line, "\t", editorTab)] = line
+		}
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if original, ok := tabbed[line]; ok {
+			lines[i] = original
+		}
+	}
+	return storage.NormalizeText(strings.Join(lines, "\n"))
+}
+
+// checkEdit reports why text can't replace the command being edited
+func (m PopModel) checkEdit(text string) error {
+	return storage.CheckText(m.commands, m.editID, text)
+}
+
+// saveEdit validates the edit form and stores the command. Errors keep
+// the form open with the reason in the status line. Text that is not
+// valid shell syntax is only saved when Save is pressed a second time.
+func (m *PopModel) saveEdit() {
+	text := m.editorText()
+	if err := m.checkEdit(text); err != nil {
+		m.status = err.Error()
+		return
+	}
+	if text != m.editOriginal && text != m.editWarned {
+		if _, err := syntaxKinds(text); err != nil {
+			m.editWarned = text
+			m.status = "Not valid shell syntax: " + err.Error() + ". Press " + firstKey(m.keys.edit.Save) + " again to save anyway."
+			return
+		}
+	}
+
+	err := m.storage.Update(storage.Command{
+		ID:          m.editID,
+		Text:        text,
+		Tags:        storage.ParseTags(m.tagInput.Value()),
+		Description: m.descInput.Value(),
+	})
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	m.reload()
+	m.filtered = m.filterCommands("")
+	m.stopEdit()
+	m.cursor = 0
+}
+
+// externalEditMsg reports that the external editor has exited
+type externalEditMsg struct {
+	path string
+	err  error
+}
+
+// openExternalEditor suspends the UI and edits the form in $VISUAL or
+// $EDITOR, through a temporary file holding the description and tags as
+// front matter above the command. After a parse error it reopens the
+// file as the user left it.
+func (m *PopModel) openExternalEditor() tea.Cmd {
+	snippet := m.editRetry
+	if snippet == "" {
+		snippet = storage.FormatSnippet(storage.Command{
+			ID:          m.editID,
+			Text:        m.editorText(),
+			Tags:        storage.ParseTags(m.tagInput.Value()),
+			Description: m.descInput.Value(),
+		})
+	}
+
+	file, err := os.CreateTemp("", "cli-stash-*.sh")
+	if err != nil {
+		m.status = "Can't open an editor: " + err.Error()
+		return nil
+	}
+	_, err = file.WriteString(snippet)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		m.status = "Can't open an editor: " + err.Error()
+		return nil
+	}
+
+	path := file.Name()
+	return tea.ExecProcess(shell.EditCommand(path), func(err error) tea.Msg {
+		return externalEditMsg{path: path, err: err}
+	})
+}
+
+// finishExternalEdit loads the snippet saved in the external editor into
+// the edit form. When the list went straight to the editor, the command is
+// saved unless it is invalid, which leaves the form open to fix it. A
+// snippet that does not parse changes nothing and is kept for the next
+// try.
+func (m *PopModel) finishExternalEdit(msg externalEditMsg) {
+	data, readErr := os.ReadFile(msg.path)
+	os.Remove(msg.path)
+	direct := m.editDirect
+	m.editDirect = false
+	if !m.editMode {
+		return
+	}
+
+	switch {
+	case msg.err != nil:
+		if direct {
+			m.stopEdit()
+		}
+		m.status = "Editor failed, nothing saved: " + msg.err.Error()
+		return
+	case readErr != nil:
+		m.status = "Can't read the edited command: " + readErr.Error()
+		return
+	}
+
+	snippet, err := storage.ParseSnippet(string(data))
+	if err != nil {
+		m.editRetry = string(data)
+		m.status = "Can't read the edited snippet, " + err.Error() + ". Press " + firstKey(m.keys.edit.External) + " to fix it."
+		return
+	}
+	m.editRetry = ""
+	if snippet.Text != m.editorText() {
+		m.setEditorText(snippet.Text)
+	}
+	m.tagInput.SetValue(strings.Join(snippet.Tags, ", "))
+	m.tagInput.CursorEnd()
+	m.descInput.SetValue(snippet.Description)
+	m.descInput.CursorEnd()
+	if direct {
+		m.saveEdit()
+	}
+}
+
+// viewCommandField shows the command field of the edit form. While
+// another field is focused it shows the command with its shell syntax
+// coloured; while editing, it warns about text that does not parse.
+func (m PopModel) viewCommandField() string {
+	if m.editField != editFieldText {
+		lines := strings.Split(highlightShell(m.editorText(), nil, normalStyle), "\n")
+		for i, line := range lines {
+			lines[i] = truncate(dimStyle.Render(fmt.Sprintf(" %3d ", i+1))+line, m.width)
+		}
+		return strings.Join(lines[:min(len(lines), maxEditorRows)], "\n")
+	}
+	if _, err := syntaxKinds(m.cmdInput.Value()); err != nil {
+		return m.cmdInput.View() + "\n" + truncate(dimStyle.Render("Not valid shell syntax: "+err.Error()), m.width)
+	}
+	return m.cmdInput.View()
+}
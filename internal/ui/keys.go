@@ -0,0 +1,267 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/itcaat/cli-stash/internal/config"
+)
+
+// keyMaps holds the key bindings of every mode
+type keyMaps struct {
+	list     listKeyMap // saved commands, typing into the filter
+	normal   listKeyMap // saved commands, keys act directly
+	history  historyKeyMap
+	edit     editKeyMap
+	template templateKeyMap
+}
+
+// listKeyMap binds the actions on the saved commands
+type listKeyMap struct {
+	Up           key.Binding
+	Down         key.Binding
+	PageUp       key.Binding
+	PageDown     key.Binding
+	Home         key.Binding
+	End          key.Binding
+	ScrollLeft   key.Binding
+	ScrollRight  key.Binding
+	Select       key.Binding
+	Cancel       key.Binding
+	Add          key.Binding
+	Edit         key.Binding
+	EditExternal key.Binding
+	Delete       key.Binding
+	Sort         key.Binding
+	HereOnly     key.Binding
+	Promote      key.Binding
+	SwitchStash  key.Binding
+	Preview      key.Binding
+	Mode         key.Binding
+	Help         key.Binding
+}
+
+// historyKeyMap binds the actions of the shell history browser
+type historyKeyMap struct {
+	Up          key.Binding
+	Down        key.Binding
+	PageUp      key.Binding
+	PageDown    key.Binding
+	Home        key.Binding
+	End         key.Binding
+	ScrollLeft  key.Binding
+	ScrollRight key.Binding
+	Preview     key.Binding
+	Save        key.Binding
+	Back        key.Binding
+	Help        key.Binding
+}
+
+// editKeyMap binds the actions of the edit form
+type editKeyMap struct {
+	NextField key.Binding
+	PrevField key.Binding
+	Save      key.Binding
+	Newline   key.Binding
+	External  key.Binding
+	Cancel    key.Binding
+	Help      key.Binding
+}
+
+// templateKeyMap binds the actions of the placeholder form
+type templateKeyMap struct {
+	Up        key.Binding
+	Down      key.Binding
+	Complete  key.Binding
+	RunSource key.Binding
+	Next      key.Binding
+	Back      key.Binding
+	Help      key.Binding
+}
+
+// newKeyMaps builds the key maps from the configured key names
+func newKeyMaps(k config.Keys) keyMaps {
+	return keyMaps{
+		list:   newListKeyMap(k.List, "normal mode"),
+		normal: newListKeyMap(k.Normal, "filter"),
+		history: historyKeyMap{
+			Up:          binding(k.History.Up, "up"),
+			Down:        binding(k.History.Down, "down"),
+			PageUp:      binding(k.History.PageUp, "page up"),
+			PageDown:    binding(k.History.PageDown, "page down"),
+			Home:        binding(k.History.Home, "first"),
+			End:         binding(k.History.End, "last"),
+			ScrollLeft:  binding(k.History.ScrollLeft, "scroll left"),
+			ScrollRight: binding(k.History.ScrollRight, "scroll right"),
+			Preview:     binding(k.History.Preview, "preview"),
+			Save:        binding(k.History.Save, "save"),
+			Back:        binding(k.History.Back, "back"),
+			Help:        binding(k.History.Help, "help"),
+		},
+		edit: editKeyMap{
+			NextField: binding(k.Edit.NextField, "next field"),
+			PrevField: binding(k.Edit.PrevField, "previous field"),
+			Save:      binding(k.Edit.Save, "save"),
+			Newline:   binding(k.Edit.Newline, "new line"),
+			External:  binding(k.Edit.External, "open in $EDITOR"),
+			Cancel:    binding(k.Edit.Cancel, "cancel"),
+			Help:      binding(k.Edit.Help, "help"),
+		},
+		template: templateKeyMap{
+			Up:        binding(k.Template.Up, "up"),
+			Down:      binding(k.Template.Down, "down"),
+			Complete:  binding(k.Template.Complete, "complete"),
+			RunSource: binding(k.Template.RunSource, "run suggestion command"),
+			Next:      binding(k.Template.Next, "next"),
+			Back:      binding(k.Template.Back, "back"),
+			Help:      binding(k.Template.Help, "help"),
+		},
+	}
+}
+
+func newListKeyMap(k config.ListKeys, mode string) listKeyMap {
+	return listKeyMap{
+		Up:           binding(k.Up, "up"),
+		Down:         binding(k.Down, "down"),
+		PageUp:       binding(k.PageUp, "page up"),
+		PageDown:     binding(k.PageDown, "page down"),
+		Home:         binding(k.Home, "first"),
+		End:          binding(k.End, "last"),
+		ScrollLeft:   binding(k.ScrollLeft, "scroll left"),
+		ScrollRight:  binding(k.ScrollRight, "scroll right"),
+		Select:       binding(k.Select, "select"),
+		Cancel:       binding(k.Cancel, "quit"),
+		Add:          binding(k.Add, "add from history"),
+		Edit:         binding(k.Edit, "edit"),
+		EditExternal: binding(k.EditExternal, "edit in $EDITOR"),
+		Delete:       binding(k.Delete, "delete"),
+		Sort:         binding(k.Sort, "sort"),
+		HereOnly:     binding(k.HereOnly, "used here only"),
+		Promote:      binding(k.Promote, "copy to stash"),
+		SwitchStash:  binding(k.SwitchStash, "switch stash"),
+		Preview:      binding(k.Preview, "preview"),
+		Mode:         binding(k.Mode, mode),
+		Help:         binding(k.Help, "help"),
+	}
+}
+
+// binding creates a binding labelled with its keys
+func binding(keys []string, desc string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyLabel(keys...), desc))
+}
+
+// keySymbols are shorter names for keys in help texts
+var keySymbols = map[string]string{
+	"up":    "↑",
+	"down":  "↓",
+	"left":  "←",
+	"right": "→",
+}
+
+// keyLabel names keys for help texts, e.g. "↑/ctrl+p"
+func keyLabel(keys ...string) string {
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		if symbol, ok := keySymbols[k]; ok {
+			k = symbol
+		}
+		labels[i] = k
+	}
+	return strings.Join(labels, "/")
+}
+
+// firstKey names the first key of b, for hints like "Press ctrl+a"
+func firstKey(b key.Binding) string {
+	if keys := b.Keys(); len(keys) > 0 {
+		return keyLabel(keys[0])
+	}
+	return ""
+}
+
+// navigate combines up and down into one help entry
+func navigate(up, down key.Binding) key.Binding {
+	return key.NewBinding(
+		key.WithKeys(append(up.Keys(), down.Keys()...)...),
+		key.WithHelp(firstKey(up)+"/"+firstKey(down), "navigate"),
+	)
+}
+
+// ShortHelp lists the bindings of the footer
+func (k listKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{navigate(k.Up, k.Down), k.Select, k.Add, k.Edit, k.Delete, k.Help, k.Cancel}
+}
+
+// FullHelp lists the bindings of the help overlay
+func (k listKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.PageUp, k.PageDown, k.Home, k.End},
+		{k.ScrollLeft, k.ScrollRight, k.Select, k.Cancel},
+		{k.Add, k.Edit, k.EditExternal, k.Delete, k.Promote},
+		{k.Sort, k.HereOnly, k.SwitchStash, k.Preview, k.Mode, k.Help},
+	}
+}
+
+// ShortHelp lists the bindings of the footer
+func (k historyKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{navigate(k.Up, k.Down), k.Save, k.Back}
+}
+
+// FullHelp lists the bindings of the help overlay
+func (k historyKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.PageUp, k.PageDown, k.Home, k.End},
+		{k.ScrollLeft, k.ScrollRight, k.Preview, k.Save, k.Back, k.Help},
+	}
+}
+
+// ShortHelp lists the bindings of the footer
+func (k editKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.NextField, k.Save, k.Newline, k.External, k.Cancel}
+}
+
+// FullHelp lists the bindings of the help overlay
+func (k editKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.NextField, k.PrevField, k.Newline}, {k.Save, k.External, k.Cancel, k.Help}}
+}
+
+// ShortHelp lists the bindings of the footer
+func (k templateKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Next, navigate(k.Up, k.Down), k.Complete, k.Back}
+}
+
+// FullHelp lists the bindings of the help overlay
+func (k templateKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{{k.Up, k.Down, k.Complete, k.RunSource}, {k.Next, k.Back, k.Help}}
+}
+
+// newHelp creates the help view in the colours of the UI
+func newHelp() help.Model {
+	h := help.New()
+	h.Styles = help.Styles{
+		Ellipsis:       dimStyle,
+		ShortKey:       normalStyle,
+		ShortDesc:      dimStyle,
+		ShortSeparator: dimStyle,
+		FullKey:        normalStyle,
+		FullDesc:       dimStyle,
+		FullSeparator:  dimStyle,
+	}
+	return h
+}
+
+// keyMap returns the bindings of the current mode
+func (m PopModel) keyMap() help.KeyMap {
+	switch {
+	case m.template.active:
+		return m.keys.template
+	case m.editMode:
+		return m.keys.edit
+	case m.historyMode:
+		return m.keys.history
+	case m.normalMode:
+		return m.keys.normal
+	default:
+		return m.keys.list
+	}
+}
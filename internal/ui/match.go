@@ -0,0 +1,115 @@
+package ui
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/itcaat/cli-stash/internal/fuzzy"
+	"github.com/itcaat/cli-stash/internal/storage"
+)
+
+// usageWeight scales how much frecency counts next to match quality.
+// A frecency of 15 (a few uses today) gains about as much as one
+// well-placed rune.
+const usageWeight = 4
+
+// descriptionPenalty divides the score of matches found only in the
+// description, so matches on the command itself rank first
+const descriptionPenalty = 2
+
+// rankedCommand is a command with its match score
+type rankedCommand struct {
+	cmd   storage.Command
+	score int
+}
+
+// matchCommand fuzzy-matches text against a command, falling back to its
+// description
+func matchCommand(cmd storage.Command, text string) (int, bool) {
+	if result, ok := fuzzy.MatchAll(text, cmd.Text); ok {
+		return result.Score, true
+	}
+	if result, ok := fuzzy.MatchAll(text, cmd.Description); ok && cmd.Description != "" {
+		return result.Score / descriptionPenalty, true
+	}
+	return 0, false
+}
+
+// Search returns the commands matching a filter query as typed into the
+// UI, #tags included, best matches first
+func Search(commands []storage.Command, query string) []storage.Command {
+	m := PopModel{commands: commands, place: storage.CurrentPlace()}
+	return m.filterCommands(query)
+}
+
+// usageBonus grows logarithmically so heavy use can't drown out match quality
+func usageBonus(frecency float64) int {
+	return int(usageWeight * math.Log2(1+frecency))
+}
+
+// rankStrings returns the items matching query, best matches first.
+// Ties keep their original order.
+func rankStrings(items []string, query string) []string {
+	if strings.TrimSpace(query) == "" {
+		return items
+	}
+
+	type ranked struct {
+		text  string
+		score int
+	}
+	var matches []ranked
+	for _, item := range items {
+		if result, ok := fuzzy.MatchAll(query, item); ok {
+			matches = append(matches, ranked{text: item, score: result.Score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	filtered := make([]string, len(matches))
+	for i, match := range matches {
+		filtered[i] = match.text
+	}
+	return filtered
+}
+
+// highlightMatch highlights the characters of cmd matched by query
+func highlightMatch(cmd, query string) string {
+	result, ok := fuzzy.MatchAll(query, cmd)
+	if query == "" || !ok {
+		return cmd
+	}
+	return highlightPositions(cmd, result.Positions, func(s string) string { return s })
+}
+
+// highlightPositions renders the runes at positions with matchStyle and
+// the runs between them with render
+func highlightPositions(text string, positions []int, render func(string) string) string {
+	var b strings.Builder
+	runes := []rune(text)
+	next := 0
+
+	for start := 0; start < len(runes); {
+		matched := next < len(positions) && positions[next] == start
+		end := start
+		for end < len(runes) && (next < len(positions) && positions[next] == end) == matched {
+			if matched {
+				next++
+			}
+			end++
+		}
+
+		if matched {
+			b.WriteString(matchStyle.Render(string(runes[start:end])))
+		} else {
+			b.WriteString(render(string(runes[start:end])))
+		}
+		start = end
+	}
+
+	return b.String()
+}
@@ -1,53 +1,134 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/itcaat/cli-stash/internal/config"
+	"github.com/itcaat/cli-stash/internal/fuzzy"
+	"github.com/itcaat/cli-stash/internal/placeholder"
 	"github.com/itcaat/cli-stash/internal/shell"
 	"github.com/itcaat/cli-stash/internal/storage"
 )
 
-var (
-	titleStyle = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(lipgloss.Color("205"))
-
-	selectedStyle = lipgloss.NewStyle().
-			Bold(true)
-
-	normalStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("252"))
-
-	dimStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("241"))
-
-	matchStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("42")).
-			Bold(true)
+// Fields of the edit form
+const (
+	editFieldText = iota
+	editFieldTags
+	editFieldDescription
+	editFieldCount
 )
 
 // PopModel represents the pop/list command UI
 type PopModel struct {
 	textInput     textinput.Model
-	commands      []string // saved commands
-	filtered      []string
+	commands      []storage.Command // saved commands
+	filtered      []storage.Command
 	history       []string // shell history
 	historyFilter []string
 	cursor        int
 	selected      string
+	selectedID    string
 	quitting      bool
 	historyMode   bool   // true = browsing history, false = browsing saved
 	editMode      bool   // true = editing a command
-	editOriginal  string // original command being edited
-	storage       *storage.Storage
+	editID        string // ID of the command being edited
+	editField     int    // focused field of the edit form
+	cmdInput      textarea.Model
+	editOriginal  string // text of the command before editing
+	editSource    string // text last loaded into cmdInput, before it turned tabs into spaces
+	editLoaded    string // value of cmdInput right after loading editSource
+	editWarned    string // invalid shell text saved anyway if Save is pressed again
+	editDirect    bool   // true = the list went straight to the external editor
+	editRetry     string // snippet that failed to parse, reopened by the external editor
+	editor        string // config.EditorBuiltin or config.EditorExternal
+	tagInput      textinput.Model
+	descInput     textinput.Model
+	template      templateForm // placeholder values being filled in
+	values        *storage.ValueStore
+	sortOrder     storage.SortOrder
+	place         storage.Place // where cli-stash was started
+	hereOnly      bool          // true = only commands used in place.Dir
+	status        string        // feedback shown below the list until the next key
+	stashName     string        // name of the open stash, storage.AllStashes for all
+	stashNames    []string      // stashes Tab cycles through
+	openStash     func(name string) (storage.Backend, error)
+	historyLimit  int // shell history entries offered by Ctrl+A
+	maxShow       int // rows shown in the list, 0 to fit the terminal
+	width         int // terminal size, 0 until the first tea.WindowSizeMsg
+	height        int // lines the UI may use
+	inlineHeight  int // --height in lines or percent, 0 for the full terminal
+	inlinePercent bool
+	reverse       bool // true = filter at the bottom, best matches above it
+	offset        int  // first list row shown
+	hscroll       int  // columns the cursor row is scrolled to the right
+	normalMode    bool // true = keys act on the list instead of the filter
+	preview       bool // true = details of the cursor row are shown beside the list
+	previewPos    string
+	keys          keyMaps
+	help          help.Model
+	showHelp      bool // true = the help overlay is shown
+	storage       storage.Backend
+}
+
+// Option customizes a PopModel
+type Option func(*PopModel)
+
+// WithValues remembers placeholder values in v and suggests them later
+func WithValues(v *storage.ValueStore) Option {
+	return func(m *PopModel) {
+		m.values = v
+	}
+}
+
+// WithPlace ranks commands used at place higher
+func WithPlace(place storage.Place) Option {
+	return func(m *PopModel) {
+		m.place = place
+	}
+}
+
+// WithConfig applies the behaviour settings and key bindings of cfg
+func WithConfig(cfg *config.Config) Option {
+	return func(m *PopModel) {
+		m.historyLimit = cfg.History.Limit
+		m.maxShow = cfg.UI.MaxShow
+		m.inlineHeight, m.inlinePercent, _ = config.ParseHeight(cfg.UI.Height)
+		m.reverse = cfg.UI.Reverse
+		m.preview = cfg.UI.Preview
+		m.previewPos = cfg.UI.PreviewPosition
+		m.editor = cfg.UI.Editor
+		m.keys = newKeyMaps(cfg.Keys)
+		if order, err := storage.ParseSortOrder(cfg.UI.Sort); err == nil {
+			m.sortOrder = order
+		}
+	}
+}
+
+// WithStashes lets Tab switch between the named stashes and a view of all
+// of them. current is the stash store was opened from; open opens another.
+func WithStashes(current string, names []string, open func(name string) (storage.Backend, error)) Option {
+	return func(m *PopModel) {
+		m.stashName = current
+		m.stashNames = names
+		m.openStash = open
+	}
 }
 
 // NewPopModel creates a new pop model
-func NewPopModel(store *storage.Storage) (PopModel, error) {
+func NewPopModel(store storage.Backend, opts ...Option) (PopModel, error) {
 	commands, err := store.List()
 	if err != nil {
 		return PopModel{}, err
@@ -59,12 +140,44 @@ func NewPopModel(store *storage.Storage) (PopModel, error) {
 	ti.CharLimit = 1000
 	ti.Width = 120
 
-	return PopModel{
-		textInput: ti,
-		commands:  commands,
-		filtered:  commands,
-		storage:   store,
-	}, nil
+	tags := textinput.New()
+	tags.Placeholder = "k8s, logs"
+	tags.CharLimit = 200
+	tags.Width = 120
+
+	desc := textinput.New()
+	desc.Placeholder = "What does this command do?"
+	desc.CharLimit = 500
+	desc.Width = 120
+
+	defaults := config.Default()
+	m := PopModel{
+		textInput:    ti,
+		tagInput:     tags,
+		descInput:    desc,
+		cmdInput:     newCommandEditor(),
+		template:     newTemplateForm(),
+		commands:     commands,
+		filtered:     commands,
+		sortOrder:    storage.SortFrecency,
+		historyLimit: defaults.History.Limit,
+		maxShow:      defaults.UI.MaxShow,
+		keys:         newKeyMaps(defaults.Keys),
+		help:         newHelp(),
+		storage:      store,
+	}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	storage.Sort(m.commands, m.sortOrder, m.place)
+	m.reportSkipped()
+	m.cmdInput.KeyMap.InsertNewline = m.keys.edit.Newline
+	if m.openStash == nil {
+		m.keys.list.SwitchStash.SetEnabled(false)
+		m.keys.normal.SwitchStash.SetEnabled(false)
+	}
+
+	return m, nil
 }
 
 // Init initializes the model
@@ -77,70 +190,149 @@ func (m PopModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
 	switch msg := msg.(type) {
+	case sourceMsg:
+		m.applySource(msg)
+		return m, nil
+
+	case tea.WindowSizeMsg:
+		m.setSize(msg.Width, msg.Height)
+		return m, nil
+
+	case externalEditMsg:
+		m.finishExternalEdit(msg)
+		return m, nil
+
 	case tea.KeyMsg:
+		m.status = ""
+
+		// Any key closes the help overlay
+		if m.showHelp {
+			m.showHelp = false
+			return m, nil
+		}
+
+		// Template form
+		if m.template.active {
+			return m.updateTemplate(msg)
+		}
+
 		// Edit mode
 		if m.editMode {
-			switch msg.String() {
-			case "ctrl+c", "esc":
+			keys := m.keys.edit
+			switch {
+			case key.Matches(msg, keys.Cancel):
 				// Cancel editing
-				m.editMode = false
-				m.editOriginal = ""
-				m.textInput.SetValue("")
-				m.textInput.Placeholder = "Type to filter commands..."
+				m.stopEdit()
 				return m, nil
 
-			case "enter":
-				// Save edited command
-				newText := m.textInput.Value()
-				if newText != "" && newText != m.editOriginal {
-					m.storage.Update(m.editOriginal, newText)
-					m.commands, _ = m.storage.List()
-					m.filtered = m.commands
-				}
-				m.editMode = false
-				m.editOriginal = ""
-				m.textInput.SetValue("")
-				m.textInput.Placeholder = "Type to filter commands..."
-				m.cursor = 0
+			case key.Matches(msg, keys.NextField):
+				// Cycle through the form fields
+				cmd := m.focusEditField((m.editField + 1) % editFieldCount)
+				return m, cmd
+
+			case key.Matches(msg, keys.PrevField):
+				cmd := m.focusEditField((m.editField + editFieldCount - 1) % editFieldCount)
+				return m, cmd
+
+			case key.Matches(msg, keys.Help):
+				m.showHelp = true
 				return m, nil
+
+			case key.Matches(msg, keys.Save):
+				m.saveEdit()
+				return m, nil
+
+			case key.Matches(msg, keys.External):
+				// Continue editing the command in $VISUAL or $EDITOR
+				cmd := m.openExternalEditor()
+				return m, cmd
 			}
 
-			// Update text input in edit mode
-			m.textInput, cmd = m.textInput.Update(msg)
+			// Update the focused input in edit mode
+			switch m.editField {
+			case editFieldTags:
+				m.tagInput, cmd = m.tagInput.Update(msg)
+			case editFieldDescription:
+				m.descInput, cmd = m.descInput.Update(msg)
+			default:
+				if key.Matches(msg, keys.Newline) {
+					m.growEditor()
+				}
+				m.cmdInput, cmd = m.cmdInput.Update(msg)
+			}
 			return m, cmd
 		}
 
 		// History browsing mode
 		if m.historyMode {
-			switch msg.String() {
-			case "ctrl+c", "esc":
+			keys := m.keys.history
+			switch {
+			case key.Matches(msg, keys.Back):
 				// Return to saved commands
 				m.historyMode = false
 				m.textInput.SetValue("")
 				m.textInput.Placeholder = "Type to filter commands..."
-				m.filtered = m.commands
+				m.filtered = m.filterCommands("")
 				m.cursor = 0
 				return m, nil
 
-			case "up", "ctrl+p":
-				if m.cursor > 0 {
-					m.cursor--
-				}
+			case key.Matches(msg, keys.Up):
+				m.moveCursor(m.onScreen(-1), len(m.historyFilter))
+				return m, nil
+
+			case key.Matches(msg, keys.Down):
+				m.moveCursor(m.onScreen(1), len(m.historyFilter))
+				return m, nil
+
+			case key.Matches(msg, keys.PageUp):
+				m.moveCursor(m.onScreen(-m.listRows()), len(m.historyFilter))
+				return m, nil
+
+			case key.Matches(msg, keys.PageDown):
+				m.moveCursor(m.onScreen(m.listRows()), len(m.historyFilter))
+				return m, nil
+
+			case key.Matches(msg, keys.Home):
+				m.moveCursor(-len(m.historyFilter), len(m.historyFilter))
+				return m, nil
+
+			case key.Matches(msg, keys.End):
+				m.moveCursor(len(m.historyFilter), len(m.historyFilter))
 				return m, nil
 
-			case "down", "ctrl+n":
-				if m.cursor < len(m.historyFilter)-1 {
-					m.cursor++
+			case key.Matches(msg, keys.ScrollLeft, keys.ScrollRight):
+				if m.cursor < len(m.historyFilter) {
+					m.scrollRow(key.Matches(msg, keys.ScrollRight), m.historyFilter[m.cursor])
 				}
 				return m, nil
 
-			case "enter":
+			case key.Matches(msg, keys.Preview):
+				m.togglePreview(len(m.historyFilter))
+				return m, nil
+
+			case key.Matches(msg, keys.Help):
+				m.showHelp = true
+				return m, nil
+
+			case key.Matches(msg, keys.Save):
 				// Save selected history command
 				if len(m.historyFilter) > 0 && m.cursor < len(m.historyFilter) {
-					selectedCmd := m.historyFilter[m.cursor]
-					m.storage.Add(selectedCmd)
-					m.commands, _ = m.storage.List()
-					m.filtered = m.commands
+					text := storage.NormalizeText(m.historyFilter[m.cursor])
+					var added storage.Command
+					err := storage.CheckText(nil, "", text)
+					if err == nil {
+						added, _, err = storage.Save(m.storage, storage.Command{Text: text})
+					}
+					m.reload()
+					m.filtered = m.filterCommands("")
+					if err == nil {
+						// Offer to tag the new command right away
+						m.historyMode = false
+						m.cursor = 0
+						cmd := m.startEdit(added, editFieldTags)
+						return m, cmd
+					}
+					m.status = err.Error()
 				}
 				// Return to saved commands view
 				m.historyMode = false
@@ -161,64 +353,161 @@ func (m PopModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
-		// Normal mode (saved commands)
-		switch msg.String() {
-		case "ctrl+c", "esc":
+		// Saved commands
+		keys := m.keys.list
+		if m.normalMode {
+			keys = m.keys.normal
+		} else if msg.Type == tea.KeyRunes && !msg.Alt {
+			// Printable keys always go to the filter, so any command,
+			// including one with a ?, can be searched for
+			keys = listKeyMap{}
+		}
+		switch {
+		case key.Matches(msg, keys.Cancel):
 			m.quitting = true
 			return m, tea.Quit
 
-		case "up", "ctrl+p":
-			if m.cursor > 0 {
-				m.cursor--
-			}
+		case key.Matches(msg, keys.Up):
+			m.moveCursor(m.onScreen(-1), len(m.filtered))
 			return m, nil
 
-		case "down", "ctrl+n":
-			if m.cursor < len(m.filtered)-1 {
-				m.cursor++
+		case key.Matches(msg, keys.Down):
+			m.moveCursor(m.onScreen(1), len(m.filtered))
+			return m, nil
+
+		case key.Matches(msg, keys.PageUp):
+			m.moveCursor(m.onScreen(-m.listRows()), len(m.filtered))
+			return m, nil
+
+		case key.Matches(msg, keys.PageDown):
+			m.moveCursor(m.onScreen(m.listRows()), len(m.filtered))
+			return m, nil
+
+		case key.Matches(msg, keys.Home):
+			m.moveCursor(-len(m.filtered), len(m.filtered))
+			return m, nil
+
+		case key.Matches(msg, keys.End):
+			m.moveCursor(len(m.filtered), len(m.filtered))
+			return m, nil
+
+		case key.Matches(msg, keys.ScrollLeft, keys.ScrollRight):
+			if m.cursor < len(m.filtered) {
+				m.scrollRow(key.Matches(msg, keys.ScrollRight), m.filtered[m.cursor].Text)
 			}
 			return m, nil
 
-		case "enter":
+		case key.Matches(msg, keys.Select):
 			if len(m.filtered) > 0 && m.cursor < len(m.filtered) {
-				m.selected = m.filtered[m.cursor]
+				selected := m.filtered[m.cursor]
+				if placeholders := placeholder.Parse(selected.Text); len(placeholders) > 0 {
+					// Ask for placeholder values before inserting
+					m.setNormalMode(false)
+					cmd := m.startTemplate(selected, placeholders)
+					return m, cmd
+				}
+				m.selected = selected.Text
+				m.selectedID = selected.ID
 			}
 			return m, tea.Quit
 
-		case "ctrl+a":
+		case key.Matches(msg, keys.Add):
 			// Switch to history mode
+			m.setNormalMode(false)
 			m.historyMode = true
-			m.history = shell.GetHistory(500)
+			m.history = shell.GetHistory(m.historyLimit)
 			m.historyFilter = m.history
 			m.textInput.SetValue("")
 			m.textInput.Placeholder = "Type to filter history..."
 			m.cursor = 0
 			return m, nil
 
-		case "ctrl+e":
-			// Edit the selected command
+		case key.Matches(msg, keys.Edit), key.Matches(msg, keys.EditExternal):
+			// Edit the selected command in the form or straight in $EDITOR
+			if len(m.filtered) > 0 && m.cursor < len(m.filtered) {
+				if selected := m.filtered[m.cursor]; selected.Origin != "" {
+					m.status = "Project commands are read-only. Press " + firstKey(keys.Promote) + " to copy it to your stash first."
+				} else {
+					m.setNormalMode(false)
+					cmd := m.startEdit(selected, editFieldText)
+					if m.editor == config.EditorExternal || key.Matches(msg, keys.EditExternal) {
+						m.editDirect = true
+						cmd = m.openExternalEditor()
+					}
+					return m, cmd
+				}
+			}
+			return m, nil
+
+		case key.Matches(msg, keys.Promote):
+			// Promote a project command into the personal stash
 			if len(m.filtered) > 0 && m.cursor < len(m.filtered) {
-				m.editMode = true
-				m.editOriginal = m.filtered[m.cursor]
-				m.textInput.SetValue(m.editOriginal)
-				m.textInput.Placeholder = ""
-				m.textInput.CursorEnd()
+				promoted, err := storage.Promote(m.storage, m.filtered[m.cursor])
+				if err != nil {
+					m.status = err.Error()
+					return m, nil
+				}
+				m.reload()
+				m.filtered = m.filterCommands(m.textInput.Value())
+				m.status = "Copied to your stash as " + promoted.ID
+			}
+			return m, nil
+
+		case key.Matches(msg, keys.Sort):
+			// Cycle the sort order
+			m.sortOrder = m.sortOrder.Next()
+			storage.Sort(m.commands, m.sortOrder, m.place)
+			m.filtered = m.filterCommands(m.textInput.Value())
+			m.cursor = 0
+			return m, nil
+
+		case key.Matches(msg, keys.SwitchStash):
+			// Switch to the next stash, then to all stashes at once
+			if m.openStash != nil {
+				m.switchStash(nextStash(m.stashNames, m.stashName))
 			}
 			return m, nil
 
-		case "ctrl+d", "delete":
+		case key.Matches(msg, keys.Preview):
+			m.togglePreview(len(m.filtered))
+			return m, nil
+
+		case key.Matches(msg, keys.HereOnly):
+			// Toggle showing only commands used in this directory
+			m.hereOnly = !m.hereOnly
+			m.filtered = m.filterCommands(m.textInput.Value())
+			m.cursor = 0
+			return m, nil
+
+		case key.Matches(msg, keys.Delete):
 			// Delete the selected command
 			if len(m.filtered) > 0 && m.cursor < len(m.filtered) {
 				cmdToDelete := m.filtered[m.cursor]
-				if err := m.storage.Remove(cmdToDelete); err == nil {
-					m.commands, _ = m.storage.List()
+				if err := m.storage.Remove(cmdToDelete.ID); err == nil {
+					m.reload()
 					m.filtered = m.filterCommands(m.textInput.Value())
 					if m.cursor >= len(m.filtered) && m.cursor > 0 {
 						m.cursor--
 					}
+				} else if errors.Is(err, storage.ErrReadOnly) {
+					m.status = "Project commands are read-only. Edit " + cmdToDelete.Origin + " instead."
 				}
 			}
 			return m, nil
+
+		case key.Matches(msg, keys.Mode):
+			// Switch between typing into the filter and normal mode
+			cmd := m.setNormalMode(!m.normalMode)
+			return m, cmd
+
+		case key.Matches(msg, keys.Help):
+			m.showHelp = true
+			return m, nil
+		}
+
+		if m.normalMode {
+			// Unbound keys do nothing instead of typing
+			return m, nil
 		}
 	}
 
@@ -234,61 +523,278 @@ func (m PopModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
-// filterCommands filters saved commands based on input
-func (m PopModel) filterCommands(query string) []string {
-	if query == "" {
-		return m.commands
+// Lines around the list on its screens: title, filter, counts, help and
+// the empty line after the final newline
+const listChrome = 9
+
+// defaultRows is the list height while the terminal size is unknown
+const defaultRows = 10
+
+// scrollStep is how many columns the cursor row scrolls at a time
+const scrollStep = 8
+
+// minInlineHeight keeps a few list rows in the inline mode
+const minInlineHeight = listChrome + 3
+
+// setSize fits the inputs and help to a terminal of the given size
+func (m *PopModel) setSize(width, height int) {
+	m.width, m.height = width, height
+	if m.inlineHeight > 0 {
+		lines := m.inlineHeight
+		if m.inlinePercent {
+			lines = height * m.inlineHeight / 100
+		}
+		m.height = min(max(lines, minInlineHeight), height)
+	}
+	inputWidth := max(width-3, 10) // room for the prompt and cursor
+	m.textInput.Width = inputWidth
+	m.tagInput.Width = inputWidth
+	m.descInput.Width = inputWidth
+	m.cmdInput.SetWidth(inputWidth)
+	m.template.input.Width = inputWidth
+	m.help.Width = width
+}
+
+// listRows returns how many rows of the list fit on the screen
+func (m PopModel) listRows() int {
+	rows := m.maxShow
+	if m.height > 0 {
+		fit := m.height - listChrome - m.previewLines()
+		if m.status != "" {
+			fit--
+		}
+		if rows == 0 || fit < rows {
+			rows = fit
+		}
+	} else if rows == 0 {
+		rows = defaultRows
 	}
+	return max(rows, 1)
+}
 
-	query = strings.ToLower(query)
-	var filtered []string
+// moveCursor moves the cursor by delta rows in a list of total items,
+// scrolling the list to keep it visible
+func (m *PopModel) moveCursor(delta, total int) {
+	m.cursor = max(0, min(m.cursor+delta, total-1))
+	m.offset = scrollOffset(m.offset, m.cursor, m.listRows(), total)
+	m.hscroll = 0
+}
 
-	for _, cmd := range m.commands {
-		if strings.Contains(strings.ToLower(cmd), query) {
-			filtered = append(filtered, cmd)
+// onScreen turns a move up (negative) or down the screen into a cursor
+// move, which runs the other way in the reverse layout
+func (m PopModel) onScreen(delta int) int {
+	if m.reverse {
+		return -delta
+	}
+	return delta
+}
+
+// togglePreview shows or hides the preview pane, which changes the room
+// left for a list of total items
+func (m *PopModel) togglePreview(total int) {
+	m.preview = !m.preview
+	m.offset = scrollOffset(m.offset, m.cursor, m.listRows(), total)
+}
+
+// scrollRow scrolls the text of the cursor row right or left
+func (m *PopModel) scrollRow(right bool, text string) {
+	if right {
+		m.hscroll = min(m.hscroll+scrollStep, max(lipgloss.Width(oneLine(text))-1, 0))
+	} else {
+		m.hscroll = max(m.hscroll-scrollStep, 0)
+	}
+}
+
+// scrollOffset returns the first row to show so that cursor stays visible,
+// moving the list as little as possible from offset
+func scrollOffset(offset, cursor, rows, total int) int {
+	if cursor < offset {
+		offset = cursor
+	} else if cursor >= offset+rows {
+		offset = cursor - rows + 1
+	}
+	return max(0, min(offset, total-rows))
+}
+
+// setNormalMode switches between normal mode and typing into the filter
+func (m *PopModel) setNormalMode(on bool) tea.Cmd {
+	m.normalMode = on
+	if on {
+		m.textInput.Blur()
+		return nil
+	}
+	return m.textInput.Focus()
+}
+
+// nextStash returns the stash after current in names, with a view of all
+// stashes after the last one
+func nextStash(names []string, current string) string {
+	cycle := append(append([]string{}, names...), storage.AllStashes)
+	for i, name := range cycle {
+		if name == current {
+			return cycle[(i+1)%len(cycle)]
 		}
 	}
+	return cycle[0]
+}
 
-	return filtered
+// switchStash replaces the open stash with the named one
+func (m *PopModel) switchStash(name string) {
+	store, err := m.openStash(name)
+	if err != nil {
+		m.status = err.Error()
+		return
+	}
+	m.storage = store
+	m.stashName = name
+	m.reload()
+	m.filtered = m.filterCommands(m.textInput.Value())
+	m.cursor = 0
 }
 
-// filterHistory filters shell history based on input
-func (m PopModel) filterHistory(query string) []string {
-	if query == "" {
-		return m.history
+// reload reads the saved commands again in the current sort order
+func (m *PopModel) reload() {
+	commands, err := storage.ListSorted(m.storage, m.sortOrder, m.place)
+	if err != nil {
+		return
+	}
+	m.commands = commands
+	m.reportSkipped()
+}
+
+// reportSkipped shows the project stash files the store left out in the
+// status line
+func (m *PopModel) reportSkipped() {
+	skipped := storage.Skipped(m.storage)
+	if len(skipped) == 0 {
+		return
+	}
+	messages := make([]string, len(skipped))
+	for i, err := range skipped {
+		messages[i] = err.Error()
+	}
+	m.status = "Skipped project stash: " + strings.Join(messages, "; ")
+}
+
+// startEdit opens the edit form for cmd with the given field focused
+func (m *PopModel) startEdit(cmd storage.Command, field int) tea.Cmd {
+	m.editMode = true
+	m.editID = cmd.ID
+	m.editOriginal = cmd.Text
+	m.editWarned = ""
+	m.editRetry = ""
+	m.setEditorText(cmd.Text)
+	m.tagInput.SetValue(strings.Join(cmd.Tags, ", "))
+	m.tagInput.CursorEnd()
+	m.descInput.SetValue(cmd.Description)
+	m.descInput.CursorEnd()
+	return m.focusEditField(field)
+}
+
+// stopEdit closes the edit form and restores the filter input
+func (m *PopModel) stopEdit() {
+	m.editMode = false
+	m.editID = ""
+	m.editDirect = false
+	m.editRetry = ""
+	m.cmdInput.Reset()
+	m.cmdInput.Blur()
+	m.tagInput.SetValue("")
+	m.tagInput.Blur()
+	m.descInput.SetValue("")
+	m.descInput.Blur()
+	m.textInput.SetValue("")
+	m.textInput.Placeholder = "Type to filter commands..."
+	m.textInput.Focus()
+}
+
+// focusEditField moves the cursor to a field of the edit form
+func (m *PopModel) focusEditField(field int) tea.Cmd {
+	m.editField = field
+	m.textInput.Blur()
+	m.cmdInput.Blur()
+	m.tagInput.Blur()
+	m.descInput.Blur()
+	switch field {
+	case editFieldTags:
+		return m.tagInput.Focus()
+	case editFieldDescription:
+		return m.descInput.Focus()
+	default:
+		return m.cmdInput.Focus()
 	}
+}
 
-	query = strings.ToLower(query)
-	var filtered []string
+// parseQuery splits a filter query into #tag terms and the remaining text
+func parseQuery(query string) (tags []string, text string) {
+	if !strings.Contains(query, "#") {
+		return nil, query
+	}
 
-	for _, cmd := range m.history {
-		if strings.Contains(strings.ToLower(cmd), query) {
-			filtered = append(filtered, cmd)
+	var words []string
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "#") && len(field) > 1 {
+			tags = append(tags, strings.ToLower(field[1:]))
+		} else {
+			words = append(words, field)
 		}
 	}
+	return tags, strings.Join(words, " ")
+}
 
-	return filtered
+// hasTagPrefixes reports whether cmd has a tag starting with each of prefixes
+func hasTagPrefixes(cmd storage.Command, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		found := false
+		for _, tag := range cmd.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
-// highlightMatch highlights the matching part of a command
-func highlightMatch(cmd, query string) string {
-	if query == "" {
-		return cmd
+// filterCommands fuzzy-matches saved commands against their text and
+// description, best matches first. Terms like #k8s restrict the results
+// to commands tagged k8s.
+func (m PopModel) filterCommands(query string) []storage.Command {
+	if query == "" && !m.hereOnly {
+		return m.commands
 	}
 
-	lowerCmd := strings.ToLower(cmd)
-	lowerQuery := strings.ToLower(query)
+	tags, text := parseQuery(query)
+	now := time.Now()
+	var ranked []rankedCommand
 
-	idx := strings.Index(lowerCmd, lowerQuery)
-	if idx == -1 {
-		return cmd
+	for _, cmd := range m.commands {
+		if !hasTagPrefixes(cmd, tags) || m.hereOnly && cmd.Dirs[m.place.Dir] == 0 {
+			continue
+		}
+		score, ok := matchCommand(cmd, text)
+		if ok {
+			ranked = append(ranked, rankedCommand{cmd: cmd, score: score + usageBonus(cmd.Relevance(now, m.place))})
+		}
 	}
 
-	before := cmd[:idx]
-	match := cmd[idx : idx+len(query)]
-	after := cmd[idx+len(query):]
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].score > ranked[j].score
+	})
 
-	return before + matchStyle.Render(match) + after
+	filtered := make([]storage.Command, len(ranked))
+	for i, r := range ranked {
+		filtered[i] = r.cmd
+	}
+	return filtered
+}
+
+// filterHistory fuzzy-matches shell history, best matches first
+func (m PopModel) filterHistory(query string) []string {
+	return rankStrings(m.history, query)
 }
 
 // View renders the UI
@@ -301,80 +807,294 @@ func (m PopModel) View() string {
 		return "" // main.go handles inserting into terminal
 	}
 
+	if m.showHelp {
+		s := titleStyle.Render("Keys") + "\n\n"
+		s += m.help.FullHelpView(m.keyMap().FullHelp()) + "\n\n"
+		s += dimStyle.Render("Press any key to close")
+		return s + "\n"
+	}
+
+	// Template form
+	if m.template.active {
+		return m.viewTemplate()
+	}
+
 	// Edit mode
 	if m.editMode {
 		s := titleStyle.Render("Edit Command") + "\n\n"
-		s += m.textInput.View() + "\n\n"
-		s += dimStyle.Render("Enter to save • Esc to cancel")
+		s += dimStyle.Render("Command") + "\n"
+		s += m.viewCommandField() + "\n\n"
+		s += dimStyle.Render("Tags") + "\n"
+		s += m.tagInput.View() + "\n\n"
+		s += dimStyle.Render("Description") + "\n"
+		s += m.descInput.View() + "\n\n"
+		if m.status != "" {
+			s += truncate(m.status, m.width) + "\n\n"
+		}
+		s += m.help.ShortHelpView(m.keys.edit.ShortHelp())
 		return s + "\n"
 	}
 
 	// History mode
 	if m.historyMode {
-		s := titleStyle.Render("Shell History") + " " + dimStyle.Render("- select to save") + "\n\n"
-		s += m.textInput.View() + "\n\n"
+		title := titleStyle.Render("Shell History") + " " + dimStyle.Render("- select to save")
 
+		var list, info string
 		if len(m.history) == 0 {
-			s += dimStyle.Render("No shell history found.") + "\n"
+			list = dimStyle.Render("No shell history found.") + "\n"
 		} else if len(m.historyFilter) == 0 {
-			s += dimStyle.Render("No matching commands.") + "\n"
+			list = dimStyle.Render("No matching commands.") + "\n"
 		} else {
-			s += m.renderList(m.historyFilter)
-			s += "\n" + dimStyle.Render(fmt.Sprintf("Showing %d of %d history items", len(m.historyFilter), len(m.history)))
+			list = m.withPreview(m.renderList(historyItems(m.historyFilter), m.textInput.Value()))
+			info = dimStyle.Render(fmt.Sprintf("Showing %d of %d history items", len(m.historyFilter), len(m.history)) + m.scrollInfo(len(m.historyFilter)))
 		}
-
-		s += "\n\n" + dimStyle.Render("↑/↓ navigate • Enter save • Esc back")
-		return s + "\n"
+		return m.frame(title, list, info, m.help.ShortHelpView(m.keys.history.ShortHelp()))
 	}
 
 	// Normal mode (saved commands)
-	s := titleStyle.Render("Stash") + " " + dimStyle.Render("- saved commands (sorted by usage)") + "\n\n"
-	s += m.textInput.View() + "\n\n"
+	subtitle := "- saved commands"
+	switch m.stashName {
+	case "", storage.DefaultStash:
+	case storage.AllStashes:
+		subtitle = "- all stashes"
+	default:
+		subtitle = "- " + m.stashName + " stash"
+	}
+	subtitle += fmt.Sprintf(" (sorted by %s)", m.sortOrder)
+	if m.hereOnly {
+		subtitle += " used in " + m.place.Dir
+	}
+	keys := m.keys.list
+	if m.normalMode {
+		subtitle += " [normal]"
+		keys = m.keys.normal
+	}
+	title := titleStyle.Render("Stash") + " " + dimStyle.Render(subtitle)
 
+	var list, info string
 	if len(m.commands) == 0 {
-		s += dimStyle.Render("No saved commands. Press Ctrl+A to add from history.") + "\n"
+		list = dimStyle.Render("No saved commands. Press "+firstKey(keys.Add)+" to add from history.") + "\n"
+	} else if len(m.filtered) == 0 && m.hereOnly && m.textInput.Value() == "" {
+		list = dimStyle.Render("No commands used in this directory yet. Press "+firstKey(keys.HereOnly)+" to show all.") + "\n"
 	} else if len(m.filtered) == 0 {
-		s += dimStyle.Render("No matching commands.") + "\n"
+		list = dimStyle.Render("No matching commands.") + "\n"
 	} else {
-		s += m.renderList(m.filtered)
-		s += "\n" + dimStyle.Render(fmt.Sprintf("Showing %d of %d commands", len(m.filtered), len(m.commands)))
+		_, text := parseQuery(m.textInput.Value())
+		list = m.withPreview(m.renderList(commandItems(m.filtered), text))
+		info = dimStyle.Render(fmt.Sprintf("Showing %d of %d commands", len(m.filtered), len(m.commands)) + m.scrollInfo(len(m.filtered)))
+	}
+	return m.frame(title, list, info, m.help.ShortHelpView(keys.ShortHelp()))
+}
+
+// frame lays out a list screen: the title and filter above the list, and
+// the counts, status and help below it. The reverse layout moves the
+// filter down next to the best matches and the counts up.
+func (m PopModel) frame(title, list, info, help string) string {
+	status := ""
+	if m.status != "" {
+		status = truncate(m.status, m.width) + "\n"
+	}
+
+	if m.reverse {
+		s := title + "\n\n" + status
+		if info != "" {
+			s += info + "\n\n"
+		}
+		return s + list + "\n" + m.textInput.View() + "\n\n" + help + "\n"
+	}
+
+	s := title + "\n\n" + m.textInput.View() + "\n\n" + list
+	if info != "" {
+		s += "\n" + info + "\n"
+	}
+	return s + status + "\n" + help + "\n"
+}
+
+// listItem is a row rendered by renderList
+type listItem struct {
+	text        string
+	tags        []string
+	description string
+	origin      string
+	source      string // stash name, shown as a column when several stashes are listed
+}
+
+// commandItems converts saved commands into list rows
+func commandItems(commands []storage.Command) []listItem {
+	items := make([]listItem, len(commands))
+	for i, cmd := range commands {
+		items[i] = listItem{text: cmd.Text, tags: cmd.Tags, description: cmd.Description, origin: cmd.Origin, source: cmd.Stash}
+	}
+	return items
+}
+
+// historyItems converts shell history into list rows
+func historyItems(history []string) []listItem {
+	items := make([]listItem, len(history))
+	for i, cmd := range history {
+		items[i] = listItem{text: cmd}
+	}
+	return items
+}
+
+// renderTags renders tags as dimmed #tag labels
+func renderTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	labels := make([]string, len(tags))
+	for i, tag := range tags {
+		labels[i] = "#" + tag
+	}
+	return "  " + tagStyle.Render(strings.Join(labels, " "))
+}
+
+// renderSource renders the stash column, padded to width
+func renderSource(source string, width int) string {
+	if width == 0 {
+		return ""
+	}
+	return sourceStyle.Render(source+strings.Repeat(" ", width-lipgloss.Width(source))) + "  "
+}
+
+// renderOrigin renders a badge naming the project a command comes from
+func renderOrigin(origin string) string {
+	if origin == "" {
+		return ""
 	}
+	return "  " + originStyle.Render("["+filepath.Base(filepath.Dir(origin))+"]")
+}
+
+// renderDescription renders a description dimmed beside the command
+func renderDescription(description, query string) string {
+	if description == "" {
+		return ""
+	}
+	s := dimStyle.Render("  — ")
 
-	s += "\n\n" + dimStyle.Render("↑/↓ navigate • Enter select • Ctrl+A add • Ctrl+E edit • Ctrl+D delete • Esc cancel")
+	result, ok := fuzzy.MatchAll(query, description)
+	if query == "" || !ok {
+		return s + dimStyle.Render(description)
+	}
+	return s + highlightPositions(description, result.Positions, func(s string) string { return dimStyle.Render(s) })
+}
 
-	return s + "\n"
+// renderCommand renders a command on one line with its shell syntax
+// coloured and the characters matched by query highlighted
+func renderCommand(text, query string) string {
+	return oneLine(highlightShell(text, matchPositions(text, query), lipgloss.NewStyle()))
 }
 
-// renderList renders a list of commands with cursor
-func (m PopModel) renderList(items []string) string {
-	maxShow := 10
-	start := 0
-	if m.cursor >= maxShow {
-		start = m.cursor - maxShow + 1
+// matchPositions returns the runes of text matched by query, if any
+func matchPositions(text, query string) []int {
+	if result, ok := fuzzy.MatchAll(query, oneLine(text)); query != "" && ok {
+		return result.Positions
 	}
+	return nil
+}
 
-	end := start + maxShow
-	if end > len(items) {
-		end = len(items)
+// renderList renders the visible rows of a list with cursor, highlighting query
+func (m PopModel) renderList(items []listItem, query string) string {
+	rows := m.listRows()
+	start := scrollOffset(m.offset, m.cursor, rows, len(items))
+	end := min(start+rows, len(items))
+
+	sourceWidth := 0
+	for _, item := range items[start:end] {
+		sourceWidth = max(sourceWidth, lipgloss.Width(item.source))
 	}
 
-	var s string
+	var rendered []string
 	for i := start; i < end; i++ {
-		cmd := items[i]
+		item := items[i]
 
+		var row string
 		if i == m.cursor {
-			// Selected: bright cyan with underline
-			s += selectedStyle.Render("▸ " + cmd) + "\n"
+			prefix := selectedStyle.Render("▸ ") + renderSource(item.source, sourceWidth)
+			row = prefix + m.scrolledText(item.text, query, lipgloss.Width(prefix)) + renderOrigin(item.origin) + renderTags(item.tags) + renderDescription(item.description, query)
 		} else {
-			displayCmd := highlightMatch(cmd, m.textInput.Value())
-			s += normalStyle.Render("  ") + displayCmd + "\n"
+			row = normalStyle.Render("  ") + renderSource(item.source, sourceWidth) + renderCommand(item.text, query) + renderOrigin(item.origin) + renderTags(item.tags) + renderDescription(item.description, query)
 		}
+		rendered = append(rendered, truncate(row, m.listWidth())+"\n")
 	}
 
-	return s
+	if m.reverse {
+		// Best matches at the bottom, next to the filter, which stays in
+		// place while the list shrinks
+		slices.Reverse(rendered)
+		if m.height > 0 {
+			rendered = append(slices.Repeat([]string{"\n"}, rows-len(rendered)), rendered...)
+		}
+	}
+	return strings.Join(rendered, "")
+}
+
+// scrolledText renders the text of the cursor row with the characters
+// matched by query highlighted, scrolled hscroll columns to the right with
+// an ellipsis marking the hidden start. Highlighting comes before
+// scrolling, so it stays on the matched characters.
+func (m PopModel) scrolledText(text, query string, indent int) string {
+	text = oneLine(highlightShell(text, matchPositions(text, query), selectedStyle))
+	hidden := lipgloss.Width(text) - 1
+	if m.width > 0 {
+		// Stop once the end of the text is visible
+		hidden = lipgloss.Width(text) - (m.listWidth() - indent) + 1
+	}
+	if hidden = min(m.hscroll, hidden); hidden > 0 {
+		text = selectedStyle.Render("…") + ansi.TruncateLeft(text, hidden+1, "")
+	}
+	return text
+}
+
+// scrollInfo tells which rows of a list of total items are shown, if not all
+func (m PopModel) scrollInfo(total int) string {
+	rows := m.listRows()
+	if total <= rows {
+		return ""
+	}
+	start := scrollOffset(m.offset, m.cursor, rows, total)
+	end := min(start+rows, total)
+
+	before, after := "↑", "↓"
+	if m.reverse {
+		before, after = after, before
+	}
+	arrows := ""
+	if start > 0 {
+		arrows += before
+	}
+	if end < total {
+		arrows += after
+	}
+	return fmt.Sprintf(" • rows %d-%d %s", start+1, end, arrows)
+}
+
+// truncate cuts a rendered line to width columns, if known, with an ellipsis
+func truncate(line string, width int) string {
+	if width <= 0 {
+		return line
+	}
+	return ansi.Truncate(line, width, "…")
+}
+
+// oneLine shows the line breaks of multi-line commands as ↵, one rune
+// each so that match positions stay valid
+func oneLine(text string) string {
+	return strings.ReplaceAll(text, "\n", "↵")
 }
 
 // Selected returns the selected command
 func (m PopModel) Selected() string {
 	return m.selected
 }
+
+// SelectedID returns the ID of the selected command
+func (m PopModel) SelectedID() string {
+	return m.selectedID
+}
+
+// Store returns the backend of the stash shown last, which holds the
+// selected command
+func (m PopModel) Store() storage.Backend {
+	return m.storage
+}
@@ -0,0 +1,237 @@
+package ui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/itcaat/cli-stash/internal/config"
+	"github.com/itcaat/cli-stash/internal/storage"
+)
+
+// Size limits of the preview pane
+const (
+	minPreviewWidth  = 30  // narrower right panes move to the bottom
+	autoPreviewWidth = 100 // terminals at least this wide get a right pane in auto position
+	minPreviewHeight = 3
+	maxPreviewPlaces = 5 // directories and repositories listed
+)
+
+// previewBelow reports whether the preview pane goes below the list
+func (m PopModel) previewBelow() bool {
+	switch m.previewPos {
+	case config.PreviewRight:
+		return m.width < 2*minPreviewWidth
+	case config.PreviewBottom:
+		return true
+	default:
+		return m.width < autoPreviewWidth
+	}
+}
+
+// previewWidth returns the width of a preview pane on the right
+func (m PopModel) previewWidth() int {
+	return max(m.width*2/5, minPreviewWidth)
+}
+
+// previewHeight returns the lines of a preview pane below the list,
+// without its border
+func (m PopModel) previewHeight() int {
+	if m.height <= 0 {
+		return defaultRows
+	}
+	return max((m.height-listChrome)/2, minPreviewHeight)
+}
+
+// previewLines returns the lines the preview pane takes from the list
+func (m PopModel) previewLines() int {
+	if !m.preview || !m.previewBelow() {
+		return 0
+	}
+	return m.previewHeight() + 1 // border
+}
+
+// listWidth returns the columns left for the list rows
+func (m PopModel) listWidth() int {
+	if m.preview && m.width > 0 && !m.previewBelow() {
+		return m.width - m.previewWidth() - 1 // border
+	}
+	return m.width
+}
+
+// previewCommand returns the command under the cursor, if any
+func (m PopModel) previewCommand() (storage.Command, bool) {
+	if m.historyMode {
+		if m.cursor < len(m.historyFilter) {
+			return storage.Command{Text: m.historyFilter[m.cursor]}, true
+		}
+		return storage.Command{}, false
+	}
+	if m.cursor < len(m.filtered) {
+		return m.filtered[m.cursor], true
+	}
+	return storage.Command{}, false
+}
+
+// withPreview adds the preview pane of the command under the cursor to
+// the rendered list rows, on their right or below them
+func (m PopModel) withPreview(list string) string {
+	cmd, ok := m.previewCommand()
+	if !m.preview || !ok {
+		return list
+	}
+	rows := m.listRows()
+	border := lipgloss.NewStyle().BorderForeground(dimStyle.GetForeground())
+
+	if !m.previewBelow() {
+		width := m.previewWidth()
+		pane := border.Border(lipgloss.NormalBorder(), false, false, false, true).
+			Width(width - 1).
+			Height(rows).
+			MaxHeight(rows).
+			PaddingLeft(1).
+			Render(m.renderPreview(cmd, width-2))
+		rowsBlock := lipgloss.NewStyle().Width(m.listWidth()).Render(strings.TrimSuffix(list, "\n"))
+		return lipgloss.JoinHorizontal(lipgloss.Top, rowsBlock, pane) + "\n"
+	}
+
+	height := m.previewHeight()
+	// The border separates the pane from the list, above or below it
+	style := border.Border(lipgloss.NormalBorder(), !m.reverse, false, m.reverse, false).
+		Height(height).
+		MaxHeight(height + 1)
+	if m.width > 0 {
+		style = style.Width(m.width)
+	}
+	pane := style.Render(m.renderPreview(cmd, m.width)) + "\n"
+	if m.reverse {
+		return pane + list
+	}
+	return list + pane
+}
+
+// renderPreview renders the full command and its details, wrapped to
+// width columns if known
+func (m PopModel) renderPreview(cmd storage.Command, width int) string {
+	text := normalStyle
+	if width > 0 {
+		text = text.Width(width)
+	}
+	s := text.Render(highlightShell(cmd.Text, nil, normalStyle))
+	if cmd.Description != "" {
+		s += "\n" + text.Inherit(dimStyle).Render(cmd.Description)
+	}
+	if cmd.ID == "" {
+		return s // shell history has no details
+	}
+
+	s += "\n"
+	field := func(name, value string) {
+		s += "\n" + dimStyle.Render(name+": ") + value
+	}
+	if len(cmd.Tags) > 0 {
+		field("Tags", strings.TrimSpace(renderTags(cmd.Tags)))
+	}
+	if cmd.Origin != "" {
+		field("Project", originStyle.Render(cmd.Origin))
+	} else {
+		field("Stash", sourceStyle.Render(m.stashOf(cmd)))
+	}
+
+	now := time.Now()
+	if !cmd.CreatedAt.IsZero() {
+		field("Created", formatTime(cmd.CreatedAt, now))
+	}
+	switch {
+	case cmd.UseCount == 0:
+		field("Used", "never")
+	case cmd.LastUsedAt.IsZero():
+		field("Used", times(cmd.UseCount))
+	default:
+		field("Used", times(cmd.UseCount)+", last "+formatTime(cmd.LastUsedAt, now))
+	}
+	if places := topPlaces(cmd.Dirs); places != "" {
+		field("Directories", places)
+	}
+	if places := topPlaces(cmd.Repos); places != "" {
+		field("Repositories", places)
+	}
+	return s
+}
+
+// stashOf names the stash holding cmd
+func (m PopModel) stashOf(cmd storage.Command) string {
+	switch {
+	case cmd.Stash != "":
+		return cmd.Stash
+	case m.stashName != "":
+		return m.stashName
+	default:
+		return storage.DefaultStash
+	}
+}
+
+// times counts uses, e.g. "1 time" or "3 times"
+func times(n int) string {
+	if n == 1 {
+		return "1 time"
+	}
+	return fmt.Sprintf("%d times", n)
+}
+
+// formatTime shows a time with how long ago it was, e.g.
+// "2026-01-02 15:04 (3 hours ago)"
+func formatTime(t, now time.Time) string {
+	return t.Local().Format("2006-01-02 15:04") + dimStyle.Render(" ("+ago(now.Sub(t))+")")
+}
+
+// ago describes a duration in the past in words
+func ago(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit + " ago"
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d < 365*24*time.Hour:
+		return plural(int(d/(30*24*time.Hour)), "month")
+	default:
+		return plural(int(d/(365*24*time.Hour)), "year")
+	}
+}
+
+// topPlaces lists the most used directories or repositories with their
+// use counts, e.g. "/src/app (4×), /tmp (1×)"
+func topPlaces(counts map[string]int) string {
+	places := make([]string, 0, len(counts))
+	for place := range counts {
+		places = append(places, place)
+	}
+	sort.Slice(places, func(i, j int) bool {
+		if counts[places[i]] != counts[places[j]] {
+			return counts[places[i]] > counts[places[j]]
+		}
+		return places[i] < places[j]
+	})
+
+	more := ""
+	if len(places) > maxPreviewPlaces {
+		more = fmt.Sprintf(", … %d more", len(places)-maxPreviewPlaces)
+		places = places[:maxPreviewPlaces]
+	}
+	for i, place := range places {
+		places[i] = fmt.Sprintf("%s (%d×)", place, counts[place])
+	}
+	return strings.Join(places, ", ") + more
+}
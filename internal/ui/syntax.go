@@ -0,0 +1,178 @@
+package ui
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/itcaat/cli-stash/internal/placeholder"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// syntaxKind is the shell syntax element a character belongs to
+type syntaxKind uint8
+
+const (
+	kindPlain    syntaxKind = iota
+	kindProgram             // command names and declaration builtins
+	kindFlag                // -x and --long options
+	kindString              // quoted strings
+	kindVariable            // $var, ${var}, assignments and placeholders
+	kindOperator            // pipes, && and ||, redirects
+)
+
+// style returns the style of k, or false for plain text
+func (k syntaxKind) style() (lipgloss.Style, bool) {
+	switch k {
+	case kindProgram:
+		return programStyle, true
+	case kindFlag:
+		return flagStyle, true
+	case kindString:
+		return stringStyle, true
+	case kindVariable:
+		return variableStyle, true
+	case kindOperator:
+		return operatorStyle, true
+	default:
+		return lipgloss.Style{}, false
+	}
+}
+
+// syntaxKinds parses cmd as bash and returns the kind of each of its
+// runes. Placeholders count as variables. Commands that do not parse,
+// like an unterminated quote, are returned as an error.
+func syntaxKinds(cmd string) ([]syntaxKind, error) {
+	// Placeholders like <pod> would read as redirects, so parse a
+	// neutral word of the same length in their place
+	src := []byte(cmd)
+	spans := placeholder.Spans(cmd)
+	for _, span := range spans {
+		for i := span[0]; i < span[1]; i++ {
+			src[i] = '_'
+		}
+	}
+
+	parser := syntax.NewParser(syntax.Variant(syntax.LangBash))
+	file, err := parser.Parse(strings.NewReader(string(src)), "")
+	if err != nil {
+		return nil, err
+	}
+
+	kinds := make([]syntaxKind, len(src))
+	fill := func(start, end uint, kind syntaxKind) {
+		for i := start; i < end && i < uint(len(kinds)); i++ {
+			kinds[i] = kind
+		}
+	}
+	mark := func(start, end syntax.Pos, kind syntaxKind) {
+		if start.IsValid() && end.IsValid() {
+			fill(start.Offset(), end.Offset(), kind)
+		}
+	}
+	markOp := func(pos syntax.Pos, op string) {
+		if pos.IsValid() {
+			fill(pos.Offset(), pos.Offset()+uint(len(op)), kindOperator)
+		}
+	}
+
+	// Walk visits parents first, so inner nodes win: "$x" is a string
+	// with a variable inside
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch n := node.(type) {
+		case *syntax.CallExpr:
+			for i, arg := range n.Args {
+				if i == 0 {
+					mark(arg.Pos(), arg.End(), kindProgram)
+				} else if lit, ok := arg.Parts[0].(*syntax.Lit); ok && strings.HasPrefix(lit.Value, "-") {
+					mark(lit.Pos(), lit.End(), kindFlag)
+				}
+			}
+		case *syntax.DeclClause:
+			mark(n.Variant.Pos(), n.Variant.End(), kindProgram)
+		case *syntax.Assign:
+			if n.Name != nil {
+				mark(n.Name.Pos(), n.Name.End(), kindVariable)
+			}
+		case *syntax.SglQuoted, *syntax.DblQuoted:
+			mark(n.Pos(), n.End(), kindString)
+		case *syntax.ParamExp:
+			mark(n.Pos(), n.End(), kindVariable)
+		case *syntax.BinaryCmd:
+			markOp(n.OpPos, n.Op.String())
+		case *syntax.Redirect:
+			if n.N != nil {
+				mark(n.N.Pos(), n.N.End(), kindOperator)
+			}
+			markOp(n.OpPos, n.Op.String())
+		}
+		return true
+	})
+	for _, span := range spans {
+		fill(uint(span[0]), uint(span[1]), kindVariable)
+	}
+
+	// One kind per rune rather than per byte
+	runes := make([]syntaxKind, 0, utf8.RuneCountInString(cmd))
+	for i := range cmd {
+		runes = append(runes, kinds[i])
+	}
+	return runes, nil
+}
+
+// CheckSyntax reports why cmd does not parse as bash. Placeholders are
+// fine.
+func CheckSyntax(cmd string) error {
+	_, err := syntaxKinds(cmd)
+	return err
+}
+
+// highlightShell renders cmd with its shell syntax coloured and the runes
+// at positions in matchStyle. Everything else, and commands that do not
+// parse, are rendered with base, which also adds its bold or underline to
+// the syntax colours. Line breaks are kept.
+func highlightShell(cmd string, positions []int, base lipgloss.Style) string {
+	kinds, err := syntaxKinds(cmd)
+	if err != nil {
+		kinds = make([]syntaxKind, utf8.RuneCountInString(cmd))
+	}
+
+	var b strings.Builder
+	runes := []rune(cmd)
+	next := 0
+	style := func(i int) (kind syntaxKind, matched bool) {
+		for next < len(positions) && positions[next] < i {
+			next++
+		}
+		return kinds[i], next < len(positions) && positions[next] == i
+	}
+
+	for start := 0; start < len(runes); {
+		if runes[start] == '\n' {
+			// lipgloss would pad the lines of a multi-line run
+			b.WriteByte('\n')
+			start++
+			continue
+		}
+		kind, matched := style(start)
+		end := start + 1
+		for end < len(runes) && runes[end] != '\n' {
+			if k, m := style(end); k != kind || m != matched {
+				break
+			}
+			end++
+		}
+
+		text := string(runes[start:end])
+		switch s, ok := kind.style(); {
+		case matched:
+			b.WriteString(matchStyle.Render(text))
+		case ok:
+			b.WriteString(s.Inherit(base).Render(text))
+		default:
+			b.WriteString(base.Render(text))
+		}
+		start = end
+	}
+	return b.String()
+}
@@ -0,0 +1,283 @@
+package ui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/itcaat/cli-stash/internal/placeholder"
+	"github.com/itcaat/cli-stash/internal/shell"
+	"github.com/itcaat/cli-stash/internal/storage"
+)
+
+// sourceTimeout limits how long a placeholder's suggestion command may run
+var sourceTimeout = 5 * time.Second
+
+// sourceMsg carries the output of a placeholder's suggestion command
+type sourceMsg struct {
+	commandID string
+	index     int
+	lines     []string
+	err       error
+}
+
+// runSource runs a placeholder's suggestion command in the background
+func runSource(commandID string, index int, source string) tea.Cmd {
+	return func() tea.Msg {
+		lines, err := shell.CaptureOutput(source, sourceTimeout)
+		return sourceMsg{commandID: commandID, index: index, lines: lines, err: err}
+	}
+}
+
+// templateForm holds the state of the placeholder form shown when a
+// command with placeholders is selected
+type templateForm struct {
+	active       bool
+	command      storage.Command
+	placeholders []placeholder.Placeholder
+	index        int               // placeholder being filled
+	values       map[string]string // values entered so far
+	input        textinput.Model
+	suggestions  []string // remembered and sourced values for the current placeholder
+	filtered     []string
+	cursor       int  // highlighted suggestion, -1 = use typed value
+	loading      bool // suggestion command still running
+	unconfirmed  bool // suggestion command of a project command, run only on request
+	missing      bool // Enter was pressed without a value for a placeholder with no default
+	sourceErr    error
+}
+
+// newTemplateForm creates an inactive template form
+func newTemplateForm() templateForm {
+	ti := textinput.New()
+	ti.CharLimit = 500
+	ti.Width = 120
+	return templateForm{input: ti, cursor: -1}
+}
+
+// current returns the placeholder being filled
+func (f templateForm) current() placeholder.Placeholder {
+	return f.placeholders[f.index]
+}
+
+// startTemplate opens the placeholder form for cmd
+func (m *PopModel) startTemplate(cmd storage.Command, placeholders []placeholder.Placeholder) tea.Cmd {
+	m.template.active = true
+	m.template.command = cmd
+	m.template.placeholders = placeholders
+	m.template.values = make(map[string]string)
+	m.template.input.Focus()
+	m.textInput.Blur()
+	return m.askPlaceholder(0)
+}
+
+// askPlaceholder prepares the form for the placeholder at index, starting
+// its suggestion command if it has one. Project commands come from files
+// checked into repositories, so their suggestion commands wait until the
+// user has seen them and asks to run them.
+func (m *PopModel) askPlaceholder(index int) tea.Cmd {
+	f := &m.template
+	f.index = index
+	p := f.current()
+
+	f.input.SetValue("")
+	f.input.Placeholder = p.Default
+
+	f.suggestions = nil
+	if m.values != nil {
+		f.suggestions = m.values.Values(p.Name)
+	}
+	f.filtered = f.suggestions
+	f.cursor = -1
+	f.sourceErr = nil
+	f.loading = false
+	f.unconfirmed = false
+	f.missing = false
+
+	switch {
+	case p.Source == "":
+		return nil
+	case f.command.Origin != "":
+		f.unconfirmed = true
+		return nil
+	}
+	return m.startSource()
+}
+
+// startSource runs the suggestion command of the current placeholder
+func (m *PopModel) startSource() tea.Cmd {
+	f := &m.template
+	f.loading = true
+	f.unconfirmed = false
+	return runSource(f.command.ID, f.index, f.current().Source)
+}
+
+// applySource adds a suggestion command's output to the current placeholder
+func (m *PopModel) applySource(msg sourceMsg) {
+	f := &m.template
+	if !f.active || msg.commandID != f.command.ID || msg.index != f.index {
+		return // the user has moved on
+	}
+
+	f.loading = false
+	f.sourceErr = msg.err
+
+	seen := make(map[string]bool)
+	for _, s := range f.suggestions {
+		seen[s] = true
+	}
+	for _, line := range msg.lines {
+		if !seen[line] {
+			seen[line] = true
+			f.suggestions = append(f.suggestions, line)
+		}
+	}
+	f.filtered = filterSuggestions(f.suggestions, f.input.Value())
+}
+
+// stopTemplate closes the placeholder form and returns to the list
+func (m *PopModel) stopTemplate() {
+	m.template.active = false
+	m.template.input.Blur()
+	m.textInput.Focus()
+}
+
+// filterSuggestions fuzzy-matches the suggestions against query, best first
+func filterSuggestions(suggestions []string, query string) []string {
+	return rankStrings(suggestions, query)
+}
+
+// updateTemplate handles keys while the placeholder form is shown
+func (m PopModel) updateTemplate(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	f := &m.template
+	keys := m.keys.template
+
+	switch {
+	case key.Matches(msg, keys.Back):
+		// Back to the list without selecting
+		m.stopTemplate()
+		return m, nil
+
+	case key.Matches(msg, keys.Up):
+		if f.cursor > -1 {
+			f.cursor--
+		}
+		return m, nil
+
+	case key.Matches(msg, keys.Down):
+		if f.cursor < len(f.filtered)-1 {
+			f.cursor++
+		}
+		return m, nil
+
+	case key.Matches(msg, keys.Help):
+		m.showHelp = true
+		return m, nil
+
+	case f.unconfirmed && key.Matches(msg, keys.RunSource):
+		cmd := m.startSource()
+		return m, cmd
+
+	case key.Matches(msg, keys.Complete):
+		// Complete the input with the highlighted (or first) suggestion
+		if len(f.filtered) > 0 {
+			i := f.cursor
+			if i < 0 {
+				i = 0
+			}
+			f.input.SetValue(f.filtered[i])
+			f.input.CursorEnd()
+			f.filtered = filterSuggestions(f.suggestions, f.input.Value())
+			f.cursor = -1
+		}
+		return m, nil
+
+	case key.Matches(msg, keys.Next):
+		value := f.input.Value()
+		if f.cursor >= 0 && f.cursor < len(f.filtered) {
+			value = f.filtered[f.cursor]
+		} else if value == "" {
+			value = f.current().Default
+		}
+		if value == "" {
+			// Placeholders without a default must be filled in, or
+			// rm -rf <dir>/ would become rm -rf /
+			f.missing = true
+			return m, nil
+		}
+		f.values[f.current().Name] = value
+
+		if f.index < len(f.placeholders)-1 {
+			cmd := m.askPlaceholder(f.index + 1)
+			return m, cmd
+		}
+
+		// All placeholders filled: select the rendered command
+		if m.values != nil {
+			m.values.Remember(f.values)
+		}
+		m.selected = placeholder.Render(f.command.Text, f.values)
+		m.selectedID = f.command.ID
+		m.stopTemplate()
+		return m, tea.Quit
+	}
+
+	var cmd tea.Cmd
+	prevValue := f.input.Value()
+	f.input, cmd = f.input.Update(msg)
+	if f.input.Value() != prevValue {
+		f.filtered = filterSuggestions(f.suggestions, f.input.Value())
+		f.cursor = -1
+		f.missing = false
+	}
+	return m, cmd
+}
+
+// viewTemplate renders the placeholder form
+func (m PopModel) viewTemplate() string {
+	f := m.template
+	p := f.current()
+
+	s := titleStyle.Render("Fill Placeholders") + " " +
+		dimStyle.Render(fmt.Sprintf("- %d of %d", f.index+1, len(f.placeholders))) + "\n\n"
+	s += normalStyle.Render(placeholder.Render(f.command.Text, f.values)) + "\n\n"
+
+	label := p.Name
+	if p.Default != "" {
+		label += dimStyle.Render(" (default: " + p.Default + ")")
+	}
+	s += label + "\n"
+	s += f.input.View() + "\n"
+
+	if f.missing {
+		s += selectedStyle.Render("  "+p.Name+" has no default, enter a value") + "\n"
+	}
+	if f.unconfirmed {
+		s += dimStyle.Render("  Suggestions from "+f.command.Origin+" come from: ") + normalStyle.Render(p.Source) + "\n"
+		s += dimStyle.Render("  Press "+firstKey(m.keys.template.RunSource)+" to run it.") + "\n"
+	} else if f.loading {
+		s += dimStyle.Render("  Loading suggestions from: "+p.Source) + "\n"
+	} else if f.sourceErr != nil {
+		s += dimStyle.Render("  Suggestions unavailable: "+f.sourceErr.Error()) + "\n"
+	}
+
+	if len(f.filtered) > 0 {
+		s += "\n"
+		for i, suggestion := range f.filtered {
+			if i >= 10 {
+				s += dimStyle.Render(fmt.Sprintf("  … %d more", len(f.filtered)-i)) + "\n"
+				break
+			}
+			if i == f.cursor {
+				s += selectedStyle.Render("▸ "+suggestion) + "\n"
+			} else {
+				s += "  " + highlightMatch(suggestion, f.input.Value()) + "\n"
+			}
+		}
+	}
+
+	s += "\n" + m.help.ShortHelpView(m.keys.template.ShortHelp())
+	return s + "\n"
+}
@@ -0,0 +1,251 @@
+package ui
+
+import (
+	"os"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/itcaat/cli-stash/internal/config"
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// Styles of the UI, set by ApplyTheme
+var (
+	titleStyle    lipgloss.Style
+	selectedStyle lipgloss.Style
+	normalStyle   lipgloss.Style
+	dimStyle      lipgloss.Style
+	matchStyle    lipgloss.Style
+	tagStyle      lipgloss.Style
+	originStyle   lipgloss.Style
+	sourceStyle   lipgloss.Style
+
+	// Shell syntax highlighting
+	programStyle  lipgloss.Style
+	flagStyle     lipgloss.Style
+	stringStyle   lipgloss.Style
+	variableStyle lipgloss.Style
+	operatorStyle lipgloss.Style
+)
+
+func init() {
+	setTheme(builtinTheme(config.ThemeAuto))
+}
+
+// theme colours the elements of the UI
+type theme struct {
+	title, normal, selected, dim, match, tag, origin, source lipgloss.TerminalColor
+	program, flag, str, variable, operator                   lipgloss.TerminalColor // shell syntax
+	underline                                                bool                   // underline matched characters too, not only colour them
+}
+
+// palette gives every element a colour for truecolor, 256 colour and 16
+// colour terminals
+type palette struct {
+	title, normal, selected, dim, match, tag, origin, source lipgloss.CompleteColor
+	program, flag, str, variable, operator                   lipgloss.CompleteColor
+}
+
+var darkPalette = palette{
+	title:    lipgloss.CompleteColor{TrueColor: "#ff5faf", ANSI256: "205", ANSI: "13"},
+	normal:   lipgloss.CompleteColor{TrueColor: "#d0d0d0", ANSI256: "252", ANSI: "7"},
+	selected: lipgloss.CompleteColor{TrueColor: "#ffffff", ANSI256: "231", ANSI: "15"},
+	dim:      lipgloss.CompleteColor{TrueColor: "#626262", ANSI256: "241", ANSI: "8"},
+	match:    lipgloss.CompleteColor{TrueColor: "#00d787", ANSI256: "42", ANSI: "10"},
+	tag:      lipgloss.CompleteColor{TrueColor: "#875fff", ANSI256: "99", ANSI: "12"},
+	origin:   lipgloss.CompleteColor{TrueColor: "#ffaf00", ANSI256: "214", ANSI: "11"},
+	source:   lipgloss.CompleteColor{TrueColor: "#5fafff", ANSI256: "75", ANSI: "14"},
+	program:  lipgloss.CompleteColor{TrueColor: "#5fd7ff", ANSI256: "81", ANSI: "14"},
+	flag:     lipgloss.CompleteColor{TrueColor: "#87afd7", ANSI256: "110", ANSI: "6"},
+	str:      lipgloss.CompleteColor{TrueColor: "#ffd787", ANSI256: "222", ANSI: "11"},
+	variable: lipgloss.CompleteColor{TrueColor: "#d787d7", ANSI256: "176", ANSI: "13"},
+	operator: lipgloss.CompleteColor{TrueColor: "#ff8787", ANSI256: "210", ANSI: "9"},
+}
+
+var lightPalette = palette{
+	title:    lipgloss.CompleteColor{TrueColor: "#d7005f", ANSI256: "161", ANSI: "5"},
+	normal:   lipgloss.CompleteColor{TrueColor: "#262626", ANSI256: "235", ANSI: "0"},
+	selected: lipgloss.CompleteColor{TrueColor: "#000000", ANSI256: "16", ANSI: "0"},
+	dim:      lipgloss.CompleteColor{TrueColor: "#808080", ANSI256: "244", ANSI: "8"},
+	match:    lipgloss.CompleteColor{TrueColor: "#008700", ANSI256: "28", ANSI: "2"},
+	tag:      lipgloss.CompleteColor{TrueColor: "#5f00d7", ANSI256: "56", ANSI: "4"},
+	origin:   lipgloss.CompleteColor{TrueColor: "#af5f00", ANSI256: "130", ANSI: "3"},
+	source:   lipgloss.CompleteColor{TrueColor: "#005faf", ANSI256: "25", ANSI: "6"},
+	program:  lipgloss.CompleteColor{TrueColor: "#005f87", ANSI256: "24", ANSI: "4"},
+	flag:     lipgloss.CompleteColor{TrueColor: "#5f5f87", ANSI256: "60", ANSI: "6"},
+	str:      lipgloss.CompleteColor{TrueColor: "#875f00", ANSI256: "94", ANSI: "3"},
+	variable: lipgloss.CompleteColor{TrueColor: "#870087", ANSI256: "90", ANSI: "5"},
+	operator: lipgloss.CompleteColor{TrueColor: "#af0000", ANSI256: "124", ANSI: "1"},
+}
+
+var highContrastDarkPalette = palette{
+	title:    lipgloss.CompleteColor{TrueColor: "#ff87ff", ANSI256: "213", ANSI: "13"},
+	normal:   lipgloss.CompleteColor{TrueColor: "#ffffff", ANSI256: "231", ANSI: "15"},
+	selected: lipgloss.CompleteColor{TrueColor: "#ffff00", ANSI256: "226", ANSI: "11"},
+	dim:      lipgloss.CompleteColor{TrueColor: "#d0d0d0", ANSI256: "252", ANSI: "7"},
+	match:    lipgloss.CompleteColor{TrueColor: "#00ff00", ANSI256: "46", ANSI: "10"},
+	tag:      lipgloss.CompleteColor{TrueColor: "#87afff", ANSI256: "111", ANSI: "12"},
+	origin:   lipgloss.CompleteColor{TrueColor: "#ffd700", ANSI256: "220", ANSI: "11"},
+	source:   lipgloss.CompleteColor{TrueColor: "#87ffff", ANSI256: "123", ANSI: "14"},
+	program:  lipgloss.CompleteColor{TrueColor: "#00ffff", ANSI256: "51", ANSI: "14"},
+	flag:     lipgloss.CompleteColor{TrueColor: "#afd7ff", ANSI256: "153", ANSI: "12"},
+	str:      lipgloss.CompleteColor{TrueColor: "#ffff87", ANSI256: "228", ANSI: "11"},
+	variable: lipgloss.CompleteColor{TrueColor: "#ff87ff", ANSI256: "213", ANSI: "13"},
+	operator: lipgloss.CompleteColor{TrueColor: "#ff5f5f", ANSI256: "203", ANSI: "9"},
+}
+
+var highContrastLightPalette = palette{
+	title:    lipgloss.CompleteColor{TrueColor: "#870087", ANSI256: "90", ANSI: "5"},
+	normal:   lipgloss.CompleteColor{TrueColor: "#000000", ANSI256: "16", ANSI: "0"},
+	selected: lipgloss.CompleteColor{TrueColor: "#0000af", ANSI256: "19", ANSI: "4"},
+	dim:      lipgloss.CompleteColor{TrueColor: "#303030", ANSI256: "236", ANSI: "0"},
+	match:    lipgloss.CompleteColor{TrueColor: "#005f00", ANSI256: "22", ANSI: "2"},
+	tag:      lipgloss.CompleteColor{TrueColor: "#5f00af", ANSI256: "55", ANSI: "5"},
+	origin:   lipgloss.CompleteColor{TrueColor: "#5f0000", ANSI256: "52", ANSI: "1"},
+	source:   lipgloss.CompleteColor{TrueColor: "#00005f", ANSI256: "17", ANSI: "4"},
+	program:  lipgloss.CompleteColor{TrueColor: "#00005f", ANSI256: "17", ANSI: "4"},
+	flag:     lipgloss.CompleteColor{TrueColor: "#005f5f", ANSI256: "23", ANSI: "6"},
+	str:      lipgloss.CompleteColor{TrueColor: "#5f5f00", ANSI256: "58", ANSI: "3"},
+	variable: lipgloss.CompleteColor{TrueColor: "#5f005f", ANSI256: "53", ANSI: "5"},
+	operator: lipgloss.CompleteColor{TrueColor: "#870000", ANSI256: "88", ANSI: "1"},
+}
+
+// monochrome is used with NO_COLOR: no colours, only bold and underline
+var monochrome = theme{
+	title:     lipgloss.NoColor{},
+	normal:    lipgloss.NoColor{},
+	selected:  lipgloss.NoColor{},
+	dim:       lipgloss.NoColor{},
+	match:     lipgloss.NoColor{},
+	tag:       lipgloss.NoColor{},
+	origin:    lipgloss.NoColor{},
+	source:    lipgloss.NoColor{},
+	program:   lipgloss.NoColor{},
+	flag:      lipgloss.NoColor{},
+	str:       lipgloss.NoColor{},
+	variable:  lipgloss.NoColor{},
+	operator:  lipgloss.NoColor{},
+	underline: true,
+}
+
+// theme uses the palette whatever the terminal background
+func (p palette) theme() theme {
+	return theme{
+		title:    p.title,
+		normal:   p.normal,
+		selected: p.selected,
+		dim:      p.dim,
+		match:    p.match,
+		tag:      p.tag,
+		origin:   p.origin,
+		source:   p.source,
+		program:  p.program,
+		flag:     p.flag,
+		str:      p.str,
+		variable: p.variable,
+		operator: p.operator,
+	}
+}
+
+// adaptive picks the light or dark palette by the terminal background
+func adaptive(light, dark palette) theme {
+	pick := func(l, d lipgloss.CompleteColor) lipgloss.TerminalColor {
+		return lipgloss.CompleteAdaptiveColor{Light: l, Dark: d}
+	}
+	return theme{
+		title:    pick(light.title, dark.title),
+		normal:   pick(light.normal, dark.normal),
+		selected: pick(light.selected, dark.selected),
+		dim:      pick(light.dim, dark.dim),
+		match:    pick(light.match, dark.match),
+		tag:      pick(light.tag, dark.tag),
+		origin:   pick(light.origin, dark.origin),
+		source:   pick(light.source, dark.source),
+		program:  pick(light.program, dark.program),
+		flag:     pick(light.flag, dark.flag),
+		str:      pick(light.str, dark.str),
+		variable: pick(light.variable, dark.variable),
+		operator: pick(light.operator, dark.operator),
+	}
+}
+
+// builtinTheme returns the theme called name, see config.Themes
+func builtinTheme(name string) theme {
+	switch name {
+	case config.ThemeDark:
+		return darkPalette.theme()
+	case config.ThemeLight:
+		return lightPalette.theme()
+	case config.ThemeHighContrast:
+		t := adaptive(highContrastLightPalette, highContrastDarkPalette)
+		t.underline = true
+		return t
+	default:
+		return adaptive(lightPalette, darkPalette)
+	}
+}
+
+// with replaces the colours set in c
+func (t theme) with(c config.Colors) theme {
+	override := func(color *lipgloss.TerminalColor, value string) {
+		switch value {
+		case "":
+		case config.ColorNone:
+			*color = lipgloss.NoColor{}
+		default:
+			*color = lipgloss.Color(value)
+		}
+	}
+	override(&t.title, c.Title)
+	override(&t.normal, c.Normal)
+	override(&t.selected, c.Selected)
+	override(&t.dim, c.Dim)
+	override(&t.match, c.Match)
+	override(&t.tag, c.Tag)
+	override(&t.origin, c.Origin)
+	override(&t.source, c.Source)
+	override(&t.program, c.Program)
+	override(&t.flag, c.Flag)
+	override(&t.str, c.String)
+	override(&t.variable, c.Variable)
+	override(&t.operator, c.Operator)
+	return t
+}
+
+// ApplyTheme styles the UI with the named built-in theme and the colours
+// overridden in c. NO_COLOR (https://no-color.org) disables all colours
+// but keeps bold and underlined text.
+func ApplyTheme(name string, c config.Colors) {
+	if os.Getenv("NO_COLOR") != "" {
+		if term.IsTerminal(int(os.Stdout.Fd())) {
+			// lipgloss would drop all styling, not only colours
+			lipgloss.SetColorProfile(termenv.ANSI)
+		}
+		setTheme(monochrome)
+		return
+	}
+
+	t := builtinTheme(name).with(c)
+	if name == config.ThemeAuto || name == config.ThemeHighContrast {
+		// Query the terminal background now, before Bubble Tea reads input
+		lipgloss.HasDarkBackground()
+	}
+	setTheme(t)
+}
+
+// setTheme rebuilds the styles from t
+func setTheme(t theme) {
+	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(t.title)
+	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(t.selected)
+	normalStyle = lipgloss.NewStyle().Foreground(t.normal)
+	dimStyle = lipgloss.NewStyle().Foreground(t.dim)
+	matchStyle = lipgloss.NewStyle().Bold(true).Underline(t.underline).Foreground(t.match)
+	tagStyle = lipgloss.NewStyle().Foreground(t.tag)
+	originStyle = lipgloss.NewStyle().Foreground(t.origin)
+	sourceStyle = lipgloss.NewStyle().Foreground(t.source)
+	programStyle = lipgloss.NewStyle().Foreground(t.program)
+	flagStyle = lipgloss.NewStyle().Foreground(t.flag)
+	stringStyle = lipgloss.NewStyle().Foreground(t.str)
+	variableStyle = lipgloss.NewStyle().Foreground(t.variable)
+	operatorStyle = lipgloss.NewStyle().Foreground(t.operator)
+}
@@ -1,44 +1,26 @@
 package ui
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/itcaat/cli-stash/internal/config"
 	"github.com/itcaat/cli-stash/internal/storage"
 )
 
-// createTestStorage creates a storage instance with a temp directory
-func createTestStorage(t *testing.T) (*storage.Storage, func()) {
-	tmpDir, err := os.MkdirTemp("", "stash-ui-test")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-
-	// We need to create the storage manually since New() uses the real home dir
-	oldHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-
-	store, err := storage.New()
-	if err != nil {
-		os.RemoveAll(tmpDir)
-		os.Setenv("HOME", oldHome)
-		t.Fatalf("Failed to create storage: %v", err)
-	}
-
-	cleanup := func() {
-		os.RemoveAll(tmpDir)
-		os.Setenv("HOME", oldHome)
-	}
-
-	return store, cleanup
+// createTestStorage creates a storage instance in a temp directory
+func createTestStorage(t *testing.T) storage.Backend {
+	return storage.NewAt(filepath.Join(t.TempDir(), "commands.json"))
 }
 
 func TestPopModel(t *testing.T) {
-	store, cleanup := createTestStorage(t)
-	defer cleanup()
+	store := createTestStorage(t)
 
 	// Add some test commands
 	store.Add("echo hello")
@@ -66,8 +48,8 @@ func TestPopModel(t *testing.T) {
 		if len(filtered) != 1 {
 			t.Errorf("filterCommands('git') len = %d, want 1", len(filtered))
 		}
-		if len(filtered) > 0 && filtered[0] != "git status" {
-			t.Errorf("filterCommands('git')[0] = %q, want %q", filtered[0], "git status")
+		if len(filtered) > 0 && filtered[0].Text != "git status" {
+			t.Errorf("filterCommands('git')[0] = %q, want %q", filtered[0].Text, "git status")
 		}
 
 		filtered = model.filterCommands("echo")
@@ -81,6 +63,103 @@ func TestPopModel(t *testing.T) {
 		}
 	})
 
+	t.Run("FilterByTag", func(t *testing.T) {
+		model, _ := NewPopModel(store)
+		for _, cmd := range model.commands {
+			if cmd.Text == "git status" {
+				store.Update(storage.Command{ID: cmd.ID, Text: cmd.Text, Tags: []string{"git"}})
+			}
+		}
+		model, _ = NewPopModel(store)
+
+		filtered := model.filterCommands("#git")
+		if len(filtered) != 1 || filtered[0].Text != "git status" {
+			t.Errorf("filterCommands('#git') = %v, want [git status]", filtered)
+		}
+
+		filtered = model.filterCommands("#git echo")
+		if len(filtered) != 0 {
+			t.Errorf("filterCommands('#git echo') len = %d, want 0", len(filtered))
+		}
+
+		filtered = model.filterCommands("#nope")
+		if len(filtered) != 0 {
+			t.Errorf("filterCommands('#nope') len = %d, want 0", len(filtered))
+		}
+	})
+
+	t.Run("FilterByDescription", func(t *testing.T) {
+		model, _ := NewPopModel(store)
+		for _, cmd := range model.commands {
+			if cmd.Text == "ls -la" {
+				store.Update(storage.Command{ID: cmd.ID, Text: cmd.Text, Description: "List all files"})
+			}
+		}
+		model, _ = NewPopModel(store)
+
+		filtered := model.filterCommands("all files")
+		if len(filtered) != 1 || filtered[0].Text != "ls -la" {
+			t.Errorf("filterCommands('all files') = %v, want [ls -la]", filtered)
+		}
+
+		if view := model.View(); !strings.Contains(view, "List all files") {
+			t.Error("View() should show command descriptions")
+		}
+	})
+
+	t.Run("SortToggle", func(t *testing.T) {
+		model, _ := NewPopModel(store)
+		if model.sortOrder != storage.SortFrecency {
+			t.Errorf("NewPopModel() sortOrder = %v, want frecency", model.sortOrder)
+		}
+
+		newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+		newModel, _ = newModel.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+		newModel, _ = newModel.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+		popModel := newModel.(PopModel)
+		if popModel.sortOrder != storage.SortAlpha {
+			t.Fatalf("sortOrder after 3x Ctrl+S = %v, want alpha", popModel.sortOrder)
+		}
+		if popModel.filtered[0].Text != "echo hello" {
+			t.Errorf("alpha order starts with %q, want echo hello", popModel.filtered[0].Text)
+		}
+		if view := popModel.View(); !strings.Contains(view, "sorted by alpha") {
+			t.Error("View() should show the sort order")
+		}
+	})
+
+	t.Run("EditTags", func(t *testing.T) {
+		model, _ := NewPopModel(store)
+
+		newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyCtrlE})
+		popModel := newModel.(PopModel)
+		if !popModel.editMode {
+			t.Fatal("Update(Ctrl+E) should enable editMode")
+		}
+		editedID := popModel.editID
+
+		newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyTab})
+		popModel = newModel.(PopModel)
+		if popModel.editField != editFieldTags {
+			t.Fatalf("Update(Tab) editField = %d, want tags", popModel.editField)
+		}
+
+		newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(", demo")})
+		newModel, _ = newModel.(PopModel).Update(tea.KeyMsg{Type: tea.KeyEnter})
+		popModel = newModel.(PopModel)
+		if popModel.editMode {
+			t.Error("Update(Enter) should leave editMode")
+		}
+
+		cmd, err := storage.Resolve(store, editedID)
+		if err != nil {
+			t.Fatalf("Resolve() error = %v", err)
+		}
+		if !cmd.HasTag("demo") {
+			t.Errorf("edited command tags = %v, want demo", cmd.Tags)
+		}
+	})
+
 	t.Run("UpdateNavigation", func(t *testing.T) {
 		model, _ := NewPopModel(store)
 
@@ -166,21 +245,689 @@ func TestHighlightMatch(t *testing.T) {
 	}
 }
 
-func TestEmptyStorage(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "stash-empty-test")
+func TestFuzzyFilter(t *testing.T) {
+	store := createTestStorage(t)
+
+	store.Add("git commit -m main")
+	store.Add("git checkout main")
+	store.Add("echo hello")
+
+	model, _ := NewPopModel(store)
+
+	filtered := model.filterCommands("gco mn")
+	if len(filtered) != 2 {
+		t.Fatalf("filterCommands('gco mn') = %v, want the two git commands", filtered)
+	}
+
+	filtered = model.filterCommands("checkout")
+	if len(filtered) != 1 || filtered[0].Text != "git checkout main" {
+		t.Errorf("filterCommands('checkout') = %v, want [git checkout main]", filtered)
+	}
+
+	// Usage breaks ties between equally good matches
+	for _, cmd := range model.commands {
+		if cmd.Text == "git checkout main" {
+			store.IncrementUse(cmd.ID, storage.Place{})
+		}
+	}
+	model, _ = NewPopModel(store)
+	filtered = model.filterCommands("git main")
+	if len(filtered) != 2 || filtered[0].Text != "git checkout main" {
+		t.Errorf("filterCommands('git main') = %v, want git checkout main first", filtered)
+	}
+
+	model.history = []string{"grep -rn todo", "git status", "make test"}
+	if got := model.filterHistory("gst"); len(got) != 1 || got[0] != "git status" {
+		t.Errorf("filterHistory('gst') = %v, want [git status]", got)
+	}
+}
+
+func TestSaveFromHistory(t *testing.T) {
+	store := createTestStorage(t)
+	model, _ := NewPopModel(store)
+	model.historyMode = true
+	model.historyFilter = []string{"make test \r\n", " \t"}
+
+	newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	popModel := newModel.(PopModel)
+	if commands, _ := store.Load(); len(commands) != 1 || commands[0].Text != "make test" {
+		t.Errorf("saving from history = %+v, want make test normalized", commands)
+	}
+	if !popModel.editMode {
+		t.Error("saving from history should open the edit form")
+	}
+
+	model.cursor = 1
+	newModel, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	popModel = newModel.(PopModel)
+	if commands, _ := store.Load(); len(commands) != 1 {
+		t.Errorf("saving blank history = %+v, want nothing saved", commands)
+	}
+	if popModel.editMode || popModel.status != storage.ErrEmptyText.Error() {
+		t.Errorf("saving blank history status = %q, want %q", popModel.status, storage.ErrEmptyText)
+	}
+}
+
+func TestHereOnly(t *testing.T) {
+	store := createTestStorage(t)
+
+	here := storage.Place{Dir: "/src/infra"}
+	tf, _ := store.Add("terraform plan")
+	store.Add("kubectl get pods")
+	store.IncrementUse(tf.ID, here)
+
+	model, _ := NewPopModel(store, WithPlace(here))
+	newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyCtrlL})
+	popModel := newModel.(PopModel)
+	if len(popModel.filtered) != 1 || popModel.filtered[0].ID != tf.ID {
+		t.Errorf("Ctrl+L filtered = %v, want [terraform plan]", popModel.filtered)
+	}
+
+	newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyCtrlL})
+	if popModel = newModel.(PopModel); len(popModel.filtered) != 2 {
+		t.Errorf("second Ctrl+L filtered len = %d, want 2", len(popModel.filtered))
+	}
+
+	// Elsewhere nothing was used yet
+	model, _ = NewPopModel(store, WithPlace(storage.Place{Dir: "/tmp"}))
+	newModel, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlL})
+	if view := newModel.(PopModel).View(); !strings.Contains(view, "No commands used in this directory") {
+		t.Error("View() should explain the empty directory filter")
+	}
+}
+
+func TestWithConfig(t *testing.T) {
+	store := createTestStorage(t)
+	store.Add("echo hello")
+	store.Add("ls -la")
+
+	cfg := config.Default()
+	cfg.UI.MaxShow = 1
+	cfg.UI.Sort = "alpha"
+	cfg.Keys.List.Down = []string{"ctrl+j"}
+
+	model, _ := NewPopModel(store, WithConfig(cfg))
+	if model.filtered[0].Text != "echo hello" {
+		t.Errorf("first command = %q, want echo hello (alpha sort)", model.filtered[0].Text)
+	}
+	if view := model.View(); strings.Contains(view, "ls -la") {
+		t.Error("View() should show only max_show commands")
+	}
+
+	newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if popModel := newModel.(PopModel); popModel.cursor != 0 {
+		t.Errorf("unbound Down moved cursor to %d, want 0", popModel.cursor)
+	}
+	newModel, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlJ})
+	if popModel := newModel.(PopModel); popModel.cursor != 1 {
+		t.Errorf("Ctrl+J cursor = %d, want 1", popModel.cursor)
+	}
+}
+
+func TestWindowSize(t *testing.T) {
+	store := createTestStorage(t)
+	for i := 0; i < 30; i++ {
+		store.Add(fmt.Sprintf("echo %02d %s", i, strings.Repeat("x", 60)))
+	}
+
+	model, _ := NewPopModel(store)
+	newModel, _ := model.Update(tea.WindowSizeMsg{Width: 50, Height: 20})
+	popModel := newModel.(PopModel)
+
+	view := popModel.View()
+	if lines := strings.Split(view, "\n"); len(lines) != 20 {
+		t.Errorf("View() has %d lines, want the terminal height 20", len(lines))
+	}
+	for _, line := range strings.Split(view, "\n") {
+		if w := lipgloss.Width(line); w > 50 {
+			t.Errorf("line %q is %d wide, want at most 50", line, w)
+		}
+	}
+	if !strings.Contains(view, "x…") || !strings.Contains(view, "rows 1-11 ↓") {
+		t.Errorf("View() should truncate long commands and show the scroll position:\n%s", view)
+	}
+
+	t.Run("Paging", func(t *testing.T) {
+		tests := []struct {
+			key        tea.KeyType
+			wantCursor int
+			wantRows   string
+		}{
+			{tea.KeyPgDown, 11, "rows 2-12 ↑↓"},
+			{tea.KeyPgDown, 22, "rows 13-23 ↑↓"},
+			{tea.KeyEnd, 29, "rows 20-30 ↑"},
+			{tea.KeyPgUp, 18, "rows 19-29 ↑↓"},
+			{tea.KeyHome, 0, "rows 1-11 ↓"},
+		}
+		m := tea.Model(popModel)
+		for _, tt := range tests {
+			m, _ = m.Update(tea.KeyMsg{Type: tt.key})
+			if cursor := m.(PopModel).cursor; cursor != tt.wantCursor {
+				t.Errorf("%v: cursor = %d, want %d", tt.key, cursor, tt.wantCursor)
+			}
+			if view := m.View(); !strings.Contains(view, tt.wantRows) {
+				t.Errorf("%v: View() should show %q:\n%s", tt.key, tt.wantRows, view)
+			}
+		}
+	})
+
+	t.Run("HorizontalScroll", func(t *testing.T) {
+		m, _ := popModel.Update(tea.KeyMsg{Type: tea.KeyShiftRight})
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyShiftRight})
+		view := m.View()
+		if !strings.Contains(view, "▸ …") || strings.Contains(view, "▸ echo") {
+			t.Errorf("shift+right should scroll the cursor row:\n%s", view)
+		}
+
+		m, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+		if hscroll := m.(PopModel).hscroll; hscroll != 0 {
+			t.Errorf("moving the cursor should reset the scroll, hscroll = %d", hscroll)
+		}
+	})
+}
+
+func TestInlineLayout(t *testing.T) {
+	store := createTestStorage(t)
+	for i := 0; i < 30; i++ {
+		store.Add(fmt.Sprintf("echo %02d", i))
+	}
+
+	t.Run("Height", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.UI.Height = "40%"
+		model, _ := NewPopModel(store, WithConfig(cfg))
+		newModel, _ := model.Update(tea.WindowSizeMsg{Width: 80, Height: 50})
+		if lines := strings.Split(newModel.View(), "\n"); len(lines) != 20 {
+			t.Errorf("View() has %d lines, want 40%% of 50", len(lines))
+		}
+
+		// Small terminals still show a few rows
+		newModel, _ = model.Update(tea.WindowSizeMsg{Width: 80, Height: 15})
+		if lines := strings.Split(newModel.View(), "\n"); len(lines) != minInlineHeight {
+			t.Errorf("View() has %d lines, want the minimum %d", len(lines), minInlineHeight)
+		}
+	})
+
+	t.Run("Reverse", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.UI.Reverse = true
+		model, _ := NewPopModel(store, WithConfig(cfg))
+		newModel, _ := model.Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+		first := newModel.(PopModel).filtered[0].Text
+
+		lines := strings.Split(newModel.View(), "\n")
+		input := slices.IndexFunc(lines, func(line string) bool { return strings.HasPrefix(line, ">") })
+		if input < 2 || !strings.Contains(lines[input-2], "▸ "+first) {
+			t.Errorf("the best match should be right above the filter:\n%s", strings.Join(lines, "\n"))
+		}
+
+		newModel, _ = newModel.Update(tea.KeyMsg{Type: tea.KeyUp})
+		if cursor := newModel.(PopModel).cursor; cursor != 1 {
+			t.Errorf("↑ in reverse layout: cursor = %d, want 1", cursor)
+		}
+	})
+}
+
+func TestPreview(t *testing.T) {
+	store := createTestStorage(t)
+	added, _ := store.Add("for f in *.log; do\n  gzip \"$f\"\ndone")
+	added.Description = "compress logs"
+	added.Tags = []string{"logs"}
+	store.Update(added)
+	store.IncrementUse(added.ID, storage.Place{Dir: "/var/log"})
+
+	model, _ := NewPopModel(store)
+	if view := model.View(); strings.Contains(view, "Used:") {
+		t.Errorf("preview should be hidden by default:\n%s", view)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		width int
+		right bool
+	}{
+		{"Right", 120, true},
+		{"Bottom", 80, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sized, _ := model.Update(tea.WindowSizeMsg{Width: tt.width, Height: 30})
+			sized, _ = sized.Update(tea.KeyMsg{Type: tea.KeyCtrlO})
+			view := sized.View()
+			for _, want := range []string{"  gzip \"$f\"", "compress logs", "#logs", "Used: 1 time, last ", "/var/log (1×)", "Stash: default"} {
+				if !strings.Contains(view, want) {
+					t.Errorf("preview is missing %q:\n%s", want, view)
+				}
+			}
+			if lines := strings.Split(view, "\n"); len(lines) > 30 {
+				t.Errorf("View() has %d lines, want at most 30", len(lines))
+			}
+
+			row := slices.IndexFunc(strings.Split(view, "\n"), func(line string) bool { return strings.Contains(line, "▸ ") })
+			beside := strings.Contains(strings.Split(view, "\n")[row], "│")
+			if beside != tt.right {
+				t.Errorf("preview beside the cursor row = %v, want %v:\n%s", beside, tt.right, view)
+			}
+		})
+	}
+}
+
+// typeKeys sends each key name to model, like a user typing them
+func typeKeys(model tea.Model, keys ...string) tea.Model {
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "ctrl+g":
+			msg = tea.KeyMsg{Type: tea.KeyCtrlG}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		model, _ = model.Update(msg)
+	}
+	return model
+}
+
+func TestKeyBindings(t *testing.T) {
+	store := createTestStorage(t)
+	store.Add("echo hello")
+	store.Add("ls -la")
+
+	t.Run("NormalMode", func(t *testing.T) {
+		model, _ := NewPopModel(store)
+		popModel := typeKeys(model, "ctrl+g", "j").(PopModel)
+		if !popModel.normalMode || popModel.cursor != 1 || popModel.textInput.Value() != "" {
+			t.Errorf("j in normal mode: cursor = %d, filter = %q, want cursor 1 and no filter", popModel.cursor, popModel.textInput.Value())
+		}
+		if view := popModel.View(); !strings.Contains(view, "[normal]") || !strings.Contains(view, "k/j navigate") {
+			t.Errorf("View() should show normal mode and its keys:\n%s", view)
+		}
+
+		popModel = typeKeys(popModel, "k", "i", "j").(PopModel)
+		if popModel.normalMode || popModel.cursor != 0 || popModel.textInput.Value() != "j" {
+			t.Errorf("after i: normalMode = %v, filter = %q, want typing j into the filter", popModel.normalMode, popModel.textInput.Value())
+		}
+	})
+
+	t.Run("Help", func(t *testing.T) {
+		model, _ := NewPopModel(store)
+		if view := model.View(); !strings.Contains(view, "ctrl+a add from history") || !strings.Contains(view, "f1 help") {
+			t.Errorf("footer should list the bindings:\n%s", view)
+		}
+
+		newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyF1})
+		popModel := newModel.(PopModel)
+		if view := popModel.View(); !popModel.showHelp || !strings.Contains(view, "copy to stash") {
+			t.Errorf("F1 should show all bindings:\n%s", view)
+		}
+		popModel = typeKeys(popModel, "esc").(PopModel)
+		if popModel.showHelp || popModel.quitting {
+			t.Error("any key should close the help without acting")
+		}
+
+		// Printable keys are typed into the filter, even the first one
+		popModel = typeKeys(popModel, "?", "l").(PopModel)
+		if popModel.showHelp || popModel.textInput.Value() != "?l" {
+			t.Errorf("filter = %q, want ?l", popModel.textInput.Value())
+		}
+
+		// Normal mode keeps ? for help
+		popModel = typeKeys(model, "ctrl+g", "?").(PopModel)
+		if !popModel.showHelp {
+			t.Error("? in normal mode should show all bindings")
+		}
+	})
+
+	t.Run("Config", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Keys.List.Mode = []string{"esc"}
+		cfg.Keys.List.Cancel = []string{"ctrl+c"}
+
+		model, _ := NewPopModel(store, WithConfig(cfg))
+		popModel := typeKeys(model, "esc", "j").(PopModel)
+		if popModel.quitting || !popModel.normalMode || popModel.cursor != 1 {
+			t.Errorf("remapped esc: quitting = %v, normalMode = %v, want normal mode", popModel.quitting, popModel.normalMode)
+		}
+	})
+}
+
+func TestEditForm(t *testing.T) {
+	// edit opens the edit form on the only saved command
+	edit := func(t *testing.T, store storage.Backend, opts ...Option) tea.Model {
+		t.Helper()
+		model, _ := NewPopModel(store, opts...)
+		newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyCtrlE})
+		if !newModel.(PopModel).editMode {
+			t.Fatal("Update(Ctrl+E) should enable editMode")
+		}
+		return newModel
+	}
+	saved := func(t *testing.T, store storage.Backend) string {
+		t.Helper()
+		commands, _ := store.List()
+		return commands[0].Text
+	}
+
+	t.Run("MultiLine", func(t *testing.T) {
+		store := createTestStorage(t)
+		text := "cat <<-EOF\n\tindented\n\tEOF"
+		store.Add(text)
+
+		model := edit(t, store)
+		if view := model.View(); !strings.Contains(view, "  3 ") || !strings.Contains(view, "EOF") {
+			t.Errorf("View() should show the numbered lines:\n%s", view)
+		}
+
+		// Untouched commands keep their tabs
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		if got := saved(t, store); got != text {
+			t.Errorf("saved %q, want %q unchanged", got, text)
+		}
+
+		model = edit(t, store)
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyCtrlJ})
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("wc -l")})
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		// Edited commands keep the tabs of the lines left as they were
+		if got, want := saved(t, store), text+"\nwc -l"; got != want || model.(PopModel).editMode {
+			t.Errorf("saved %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		store := createTestStorage(t)
+		store.Add("ls -la")
+		store.Add("pwd")
+
+		tests := []struct {
+			name string
+			text string
+			want string
+		}{
+			{"Empty", "  ", "the command is empty"},
+			{"Duplicate", "ls -la", "already saved as"},
+			{"Syntax", "echo 'oops", "Not valid shell syntax"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				model := edit(t, store)
+				popModel := model.(PopModel)
+				popModel.setEditorText(tt.text)
+				popModel.editLoaded = "" // as if typed
+
+				newModel, _ := popModel.Update(tea.KeyMsg{Type: tea.KeyEnter})
+				popModel = newModel.(PopModel)
+				if !popModel.editMode || !strings.Contains(popModel.View(), tt.want) {
+					t.Errorf("Update(Enter) should keep the form open with %q:\n%s", tt.want, popModel.View())
+				}
+				if got := saved(t, store); got != "pwd" {
+					t.Errorf("saved %q, want pwd unchanged", got)
+				}
+			})
+		}
+
+		// Invalid shell syntax is saved when confirmed
+		model := edit(t, store)
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" 'x")})
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		model, _ = model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		if got := saved(t, store); got != "pwd 'x" || model.(PopModel).editMode {
+			t.Errorf("saved %q after confirming, want pwd 'x", got)
+		}
+	})
+
+	t.Run("External", func(t *testing.T) {
+		t.Setenv("TMPDIR", t.TempDir())
+		store := createTestStorage(t)
+		store.Add("ls")
+		cfg := config.Default()
+		cfg.UI.Editor = config.EditorExternal
+
+		model := edit(t, store, WithConfig(cfg))
+		if !model.(PopModel).editDirect {
+			t.Fatal("Ctrl+E should go straight to the external editor")
+		}
+
+		// The editor saved the file and exited
+		path := filepath.Join(t.TempDir(), "cli-stash-1.sh")
+		os.WriteFile(path, []byte("---\ndescription: List all\ntags: fs\n---\nls -la\n\n"), 0600)
+		model, _ = model.Update(externalEditMsg{path: path})
+		commands, _ := store.List()
+		if got := commands[0]; got.Text != "ls -la" || got.Description != "List all" || !got.HasTag("fs") || model.(PopModel).editMode {
+			t.Errorf("saved %+v, want the edited snippet", got)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("the temporary file should be removed")
+		}
+	})
+
+	t.Run("ExternalRetry", func(t *testing.T) {
+		t.Setenv("TMPDIR", t.TempDir())
+		store := createTestStorage(t)
+		store.Add("ls")
+
+		model, _ := NewPopModel(store)
+		newModel, cmd := model.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+		if !newModel.(PopModel).editDirect || cmd == nil {
+			t.Fatal("Ctrl+X should open the external editor")
+		}
+
+		// A snippet that does not parse is reported and kept
+		broken := "---\ntag: fs\n---\nls -la\n"
+		path := filepath.Join(t.TempDir(), "cli-stash-1.sh")
+		os.WriteFile(path, []byte(broken), 0600)
+		newModel, _ = newModel.Update(externalEditMsg{path: path})
+		popModel := newModel.(PopModel)
+		if !popModel.editMode || !strings.Contains(popModel.View(), `line 2: unknown field "tag"`) {
+			t.Errorf("Update(externalEditMsg) should keep the form open with the parse error:\n%s", popModel.View())
+		}
+		if got := saved(t, store); got != "ls" {
+			t.Errorf("saved %q, want ls unchanged", got)
+		}
+		if popModel.editRetry != broken {
+			t.Errorf("editRetry = %q, want the snippet to fix", popModel.editRetry)
+		}
+
+		// Fixed on the next try
+		newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyCtrlX})
+		os.WriteFile(path, []byte("---\ntags: fs\n---\nls -la\n"), 0600)
+		newModel, _ = newModel.Update(externalEditMsg{path: path})
+		if view := newModel.View(); !strings.Contains(view, "ls -la") || !strings.Contains(view, "fs") {
+			t.Errorf("View() should show the fixed snippet in the form:\n%s", view)
+		}
+		newModel, _ = newModel.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		commands, _ := store.List()
+		if got := commands[0]; got.Text != "ls -la" || !got.HasTag("fs") || newModel.(PopModel).editMode {
+			t.Errorf("saved %+v, want the fixed snippet", got)
+		}
+	})
+}
+
+func TestProjectCommands(t *testing.T) {
+	personal := createTestStorage(t)
+
+	dir := filepath.Join(t.TempDir(), "webapp")
+	os.Mkdir(dir, 0755)
+	os.WriteFile(filepath.Join(dir, ".stash.json"), []byte(`[{"text": "make migrate", "tags": ["db"]}]`), 0644)
+	store := storage.WithProjectFiles(personal, dir)
+
+	model, _ := NewPopModel(store)
+	if view := model.View(); !strings.Contains(view, "[webapp]") {
+		t.Error("View() should show the project badge")
+	}
+
+	newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyCtrlE})
+	popModel := newModel.(PopModel)
+	if popModel.editMode || !strings.Contains(popModel.View(), "read-only") {
+		t.Error("Ctrl+E on a project command should explain it is read-only")
+	}
+
+	newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyCtrlY})
+	popModel = newModel.(PopModel)
+	if len(popModel.commands) != 1 || popModel.commands[0].Origin != "" || !popModel.commands[0].HasTag("db") {
+		t.Errorf("Ctrl+Y commands = %+v, want the personal copy", popModel.commands)
+	}
+	if view := popModel.View(); strings.Contains(view, "[webapp]") || !strings.Contains(view, "Copied to your stash") {
+		t.Error("View() after Ctrl+Y should show the personal copy and confirm")
+	}
+}
+
+func TestBrokenProjectFile(t *testing.T) {
+	personal := createTestStorage(t)
+	personal.Add("ls -la")
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".stash.json"), []byte(`{"commands": garbage}`), 0644)
+
+	model, err := NewPopModel(storage.WithProjectFiles(personal, dir))
 	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
+		t.Fatalf("NewPopModel() with a broken project file error = %v", err)
+	}
+	if len(model.commands) != 1 || !strings.Contains(model.status, ".stash.json") {
+		t.Errorf("NewPopModel() commands = %v, status %q, want the personal command and a warning", model.commands, model.status)
+	}
+}
+
+func TestSwitchStash(t *testing.T) {
+	storage.SetDir(t.TempDir())
+	defer storage.SetDir("")
+
+	storage.CreateStash(storage.KindJSON, "work")
+	personal, _ := storage.Open(storage.KindJSON, storage.DefaultStash)
+	personal.Add("git status")
+	work, _ := storage.Open(storage.KindJSON, "work")
+	work.Add("kubectl get pods")
+
+	names, _ := storage.Stashes()
+	open := func(name string) (storage.Backend, error) {
+		return storage.Open(storage.KindJSON, name)
 	}
-	defer os.RemoveAll(tmpDir)
+	model, _ := NewPopModel(personal, WithStashes(storage.DefaultStash, names, open))
 
-	oldHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", oldHome)
+	newModel, _ := model.Update(tea.KeyMsg{Type: tea.KeyTab})
+	popModel := newModel.(PopModel)
+	if popModel.stashName != "work" || len(popModel.commands) != 1 || popModel.commands[0].Text != "kubectl get pods" {
+		t.Errorf("Tab stash = %s, commands = %v; want the work stash", popModel.stashName, popModel.commands)
+	}
+	if view := popModel.View(); !strings.Contains(view, "work stash") {
+		t.Error("View() should name the open stash")
+	}
 
-	// Create stash directory
-	os.MkdirAll(filepath.Join(tmpDir, ".stash"), 0755)
+	newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyTab})
+	popModel = newModel.(PopModel)
+	if popModel.stashName != storage.AllStashes || len(popModel.commands) != 2 {
+		t.Fatalf("second Tab stash = %s, commands = %v; want all stashes", popModel.stashName, popModel.commands)
+	}
+	view := popModel.View()
+	if !strings.Contains(view, "default") || !strings.Contains(view, "work ") {
+		t.Error("View() of all stashes should show the source column")
+	}
+
+	newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyTab})
+	if popModel = newModel.(PopModel); popModel.stashName != storage.DefaultStash {
+		t.Errorf("third Tab stash = %s, want back to default", popModel.stashName)
+	}
+
+	// A command picked in another stash records its use there
+	newModel, _ = popModel.Update(tea.KeyMsg{Type: tea.KeyTab})
+	newModel, _ = newModel.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	popModel = newModel.(PopModel)
+	if popModel.Selected() != "kubectl get pods" {
+		t.Fatalf("Selected() = %q, want kubectl get pods", popModel.Selected())
+	}
+	if err := popModel.Store().IncrementUse(popModel.SelectedID(), storage.Place{}); err != nil {
+		t.Fatalf("Store().IncrementUse() error = %v", err)
+	}
+	commands, _ := work.List()
+	if commands[0].UseCount != 1 {
+		t.Errorf("UseCount in work = %d, want 1", commands[0].UseCount)
+	}
+}
+
+func TestHighlightPositions(t *testing.T) {
+	mark := func(s string) string { return "[" + s + "]" }
+	saved := matchStyle
+	matchStyle = matchStyle.UnsetBold().UnsetForeground().Transform(mark)
+	defer func() { matchStyle = saved }()
+
+	got := highlightPositions("git checkout", []int{0, 4, 5}, func(s string) string { return s })
+	if want := "[g]it [ch]eckout"; got != want {
+		t.Errorf("highlightPositions() = %q, want %q", got, want)
+	}
+}
+
+func TestScrolledTextHighlight(t *testing.T) {
+	// Upper case marks matches without changing the width
+	saved := matchStyle
+	matchStyle = matchStyle.UnsetBold().UnsetUnderline().UnsetForeground().Transform(strings.ToUpper)
+	defer func() { matchStyle = saved }()
+
+	var model PopModel
+	if got := model.scrolledText("git status", "gst", 2); got != "Git STatus" {
+		t.Errorf("scrolledText() = %q, want the matches highlighted", got)
+	}
 
-	store, _ := storage.New()
+	// Scrolling keeps the highlights on the matched characters
+	model.hscroll = 4
+	if got := model.scrolledText("git status", "gst", 2); got != "…Tatus" {
+		t.Errorf("scrolledText() scrolled = %q, want the visible match highlighted", got)
+	}
+}
+
+func TestSyntaxKinds(t *testing.T) {
+	// One letter per rune: Program, Flag, String, Variable, Operator
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{`kubectl logs -f "$pod" | grep -i err > out.txt 2>&1`,
+			`PPPPPPP      FF SVVVVS O PPPP FF     O         OOO `},
+		{`FOO=1 make && echo ${HOME}/x`,
+			`VVV   PPPP OO PPPP VVVVVVV  `},
+		{`kubectl logs <pod> -n {{ns:default}}`,
+			`PPPPPPP      VVVVV FF VVVVVVVVVVVVVV`},
+		{`echo 'héllo' -x`,
+			`PPPP SSSSSSS FF`},
+	}
+	for _, tt := range tests {
+		kinds, err := syntaxKinds(tt.cmd)
+		if err != nil {
+			t.Errorf("syntaxKinds(%q) error = %v", tt.cmd, err)
+			continue
+		}
+		got := make([]byte, len(kinds))
+		for i, kind := range kinds {
+			got[i] = " PFSVO"[kind]
+		}
+		if string(got) != tt.want {
+			t.Errorf("syntaxKinds(%q) =\n%s\nwant\n%s", tt.cmd, got, tt.want)
+		}
+	}
+
+	// Unparsable commands are shown as they are
+	if _, err := syntaxKinds(`echo "unterminated`); err == nil {
+		t.Error("syntaxKinds() of an unterminated string: error = nil, want error")
+	}
+	if got := highlightShell(`echo "unterminated`, nil, lipgloss.NewStyle()); got != `echo "unterminated` {
+		t.Errorf("highlightShell() = %q, want the text unchanged", got)
+	}
+}
+
+func TestHighlightShell(t *testing.T) {
+	saved := []lipgloss.Style{matchStyle, programStyle, stringStyle}
+	matchStyle = lipgloss.NewStyle().Transform(func(s string) string { return "[" + s + "]" })
+	programStyle = lipgloss.NewStyle().Transform(strings.ToUpper)
+	stringStyle = lipgloss.NewStyle().Transform(func(s string) string { return "<" + s + ">" })
+	defer func() { matchStyle, programStyle, stringStyle = saved[0], saved[1], saved[2] }()
+
+	got := highlightShell("echo 'a b'\nls", []int{1, 12}, lipgloss.NewStyle())
+	if want := "E[c]HO <'a b'>\nL[s]"; got != want {
+		t.Errorf("highlightShell() = %q, want %q", got, want)
+	}
+}
+
+func TestEmptyStorage(t *testing.T) {
+	store := createTestStorage(t)
 	model, err := NewPopModel(store)
 	if err != nil {
 		t.Fatalf("NewPopModel() error = %v", err)
@@ -191,3 +938,178 @@ func TestEmptyStorage(t *testing.T) {
 		t.Error("View() should show 'No saved commands' message for empty storage")
 	}
 }
+
+func TestTemplateForm(t *testing.T) {
+	tmpDir := t.TempDir()
+	store := storage.NewAt(filepath.Join(tmpDir, "commands.json"))
+	store.Add("kubectl logs -n {{namespace:default}} <pod>")
+	values := storage.NewValueStore(filepath.Join(tmpDir, "placeholders.json"))
+	values.Remember(map[string]string{"pod": "web-1"})
+
+	model, err := NewPopModel(store, WithValues(values))
+	if err != nil {
+		t.Fatalf("NewPopModel() error = %v", err)
+	}
+
+	press := func(m PopModel, msg tea.KeyMsg) PopModel {
+		newModel, _ := m.Update(msg)
+		return newModel.(PopModel)
+	}
+
+	// Selecting a template opens the form instead of quitting
+	model = press(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if !model.template.active || model.selected != "" {
+		t.Fatal("Update(Enter) on a template should open the placeholder form")
+	}
+	if !strings.Contains(model.View(), "namespace") {
+		t.Error("View() should prompt for the first placeholder")
+	}
+
+	// Empty input takes the default
+	model = press(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.template.index != 1 {
+		t.Fatalf("template index = %d, want 1", model.template.index)
+	}
+
+	// Remembered values are offered as suggestions
+	if len(model.template.filtered) != 1 || model.template.filtered[0] != "web-1" {
+		t.Errorf("suggestions = %v, want [web-1]", model.template.filtered)
+	}
+	model = press(model, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("api-2")})
+	model = press(model, tea.KeyMsg{Type: tea.KeyEnter})
+
+	if want := "kubectl logs -n default api-2"; model.Selected() != want {
+		t.Errorf("Selected() = %q, want %q", model.Selected(), want)
+	}
+	if model.SelectedID() == "" {
+		t.Error("SelectedID() should identify the template command")
+	}
+	if got := values.Values("pod"); len(got) != 2 || got[0] != "api-2" {
+		t.Errorf("remembered pod values = %v, want api-2 first", got)
+	}
+}
+
+func TestTemplateRequired(t *testing.T) {
+	store := createTestStorage(t)
+	store.Add("rm -rf <dir>/")
+	model, _ := NewPopModel(store)
+
+	press := func(m PopModel, msg tea.KeyMsg) PopModel {
+		newModel, _ := m.Update(msg)
+		return newModel.(PopModel)
+	}
+
+	// Enter without a value keeps the form open
+	model = press(model, tea.KeyMsg{Type: tea.KeyEnter})
+	model = press(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if !model.template.active || model.Selected() != "" {
+		t.Fatalf("Enter on an empty placeholder without default selected %q", model.Selected())
+	}
+	if !strings.Contains(model.View(), "dir has no default") {
+		t.Error("View() should say the placeholder needs a value")
+	}
+
+	model = press(model, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("build")})
+	if strings.Contains(model.View(), "has no default") {
+		t.Error("typing should clear the notice")
+	}
+	model = press(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if want := "rm -rf build/"; model.Selected() != want {
+		t.Errorf("Selected() = %q, want %q", model.Selected(), want)
+	}
+}
+
+func TestTemplateSource(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	store := createTestStorage(t)
+	store.Add("kubectl logs {{pod|printf 'pod/web-1\\npod/api-2\\n'}}")
+
+	model, _ := NewPopModel(store)
+	newModel, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = newModel.(PopModel)
+	if cmd == nil || !model.template.loading {
+		t.Fatal("selecting a template with a source should start loading suggestions")
+	}
+
+	// Deliver the command's output
+	newModel, _ = model.Update(cmd())
+	model = newModel.(PopModel)
+	if model.template.loading || len(model.template.filtered) != 2 {
+		t.Fatalf("suggestions = %v (loading %v), want 2 sourced lines", model.template.filtered, model.template.loading)
+	}
+
+	// Typing narrows the list; Down + Enter picks a suggestion
+	newModel, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("api")})
+	newModel, _ = newModel.(PopModel).Update(tea.KeyMsg{Type: tea.KeyDown})
+	newModel, _ = newModel.(PopModel).Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = newModel.(PopModel)
+
+	if want := "kubectl logs pod/api-2"; model.Selected() != want {
+		t.Errorf("Selected() = %q, want %q", model.Selected(), want)
+	}
+}
+
+func TestTemplateProjectSource(t *testing.T) {
+	t.Setenv("SHELL", "/bin/sh")
+
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	project := `[{"text": "kubectl logs <pod|touch ` + marker + `; echo web-1>"}]`
+	os.WriteFile(filepath.Join(dir, ".stash.json"), []byte(project), 0644)
+	store := storage.WithProjectFiles(createTestStorage(t), dir)
+
+	model, _ := NewPopModel(store)
+	newModel, cmd := model.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	model = newModel.(PopModel)
+	if cmd != nil || model.template.loading {
+		t.Fatal("selecting a project command should not run its suggestion command")
+	}
+	if view := model.View(); !strings.Contains(view, "touch "+marker) || !strings.Contains(view, "Press ctrl+r") {
+		t.Errorf("View() should show the suggestion command and how to run it:\n%s", view)
+	}
+
+	newModel, cmd = model.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	if cmd == nil || !newModel.(PopModel).template.loading {
+		t.Fatal("Ctrl+R should run the suggestion command")
+	}
+	newModel, _ = newModel.Update(cmd())
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("the suggestion command did not run: %v", err)
+	}
+	if got := newModel.(PopModel).template.filtered; len(got) != 1 || got[0] != "web-1" {
+		t.Errorf("suggestions = %v, want [web-1]", got)
+	}
+}
+
+func TestThemes(t *testing.T) {
+	defer setTheme(builtinTheme(config.ThemeAuto))
+
+	for _, name := range config.Themes {
+		if name != config.ThemeAuto && builtinTheme(name) == builtinTheme(config.ThemeAuto) {
+			t.Errorf("builtinTheme(%q) = the auto theme, want its own", name)
+		}
+	}
+
+	theme := builtinTheme(config.ThemeLight).with(config.Colors{Title: "1", Tag: config.ColorNone})
+	if theme.title != lipgloss.Color("1") {
+		t.Errorf("title = %v, want the override", theme.title)
+	}
+	if theme.tag != (lipgloss.NoColor{}) {
+		t.Errorf("tag = %v, want no colour", theme.tag)
+	}
+	if theme.match != lightPalette.match {
+		t.Errorf("match = %v, want the light theme's", theme.match)
+	}
+
+	t.Run("NoColor", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "1")
+		ApplyTheme(config.ThemeDark, config.Colors{Title: "1"})
+		if titleStyle.GetForeground() != (lipgloss.NoColor{}) {
+			t.Errorf("title colour = %v, want none with NO_COLOR", titleStyle.GetForeground())
+		}
+		if !matchStyle.GetUnderline() || !matchStyle.GetBold() {
+			t.Error("matches should stay bold and underlined with NO_COLOR")
+		}
+	})
+}
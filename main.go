@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/atotto/clipboard"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
 
+	"github.com/itcaat/cli-stash/internal/config"
+	"github.com/itcaat/cli-stash/internal/shell"
 	"github.com/itcaat/cli-stash/internal/storage"
 	"github.com/itcaat/cli-stash/internal/terminal"
 	"github.com/itcaat/cli-stash/internal/ui"
@@ -38,9 +45,136 @@ var listCmd = &cobra.Command{
 	},
 }
 
+var (
+	listTags []string
+	listSort string
+)
+
+var addCmd = &cobra.Command{
+	Use:   "add [COMMAND|-]",
+	Short: "Save a command given as an argument, on stdin (-) or from shell history (--last)",
+	Example: `  cli-stash add "kubectl get pods -A" --tag k8s --desc "All pods"
+  cli-stash add --last
+  echo "make test" | cli-stash add - --stash work`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runAdd(args)
+	},
+}
+
+var (
+	addLast bool
+	addTags []string
+	addDesc string
+)
+
+var rmCmd = &cobra.Command{
+	Use:     "rm ID...",
+	Aliases: []string{"remove"},
+	Short:   "Remove saved commands by ID (or unique ID prefix)",
+	Args:    cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runRemove(args)
+	},
+}
+
+var promoteCmd = &cobra.Command{
+	Use:   "promote ID...",
+	Short: "Copy project commands into your personal stash",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runPromote(args)
+	},
+}
+
+var editCmd = &cobra.Command{
+	Use:   "edit ID|QUERY",
+	Short: "Edit a saved command, its description and tags in $VISUAL or $EDITOR",
+	Long: "Edit a saved command in $VISUAL or $EDITOR. The command is found by ID (or unique ID prefix),\n" +
+		"or else by a search like the one in the UI, which must single it out.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runEdit(args[0])
+	},
+}
+
+var stashesCmd = &cobra.Command{
+	Use:   "stashes",
+	Short: "List named stashes",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runStashes()
+	},
+}
+
+var stashesCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a named stash",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runStashCreate(args[0])
+	},
+}
+
+var stashesDeleteCmd = &cobra.Command{
+	Use:     "delete NAME",
+	Aliases: []string{"rm"},
+	Short:   "Delete a named stash and its commands",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runStashDelete(args[0])
+	},
+}
+
+var stashesForce bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Print the effective configuration and where each value comes from",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runConfig()
+	},
+}
+
+// cfg is the effective configuration, loaded before any command runs
+var cfg = config.Default()
+
+var (
+	backendFlag string
+	stashFlag   string
+	dataDirFlag string
+)
+
 func init() {
+	rootCmd.PersistentFlags().StringVar(&backendFlag, "backend", "", "storage backend: json or bolt (env CLI_STASH_BACKEND)")
+	rootCmd.PersistentFlags().StringVar(&dataDirFlag, "data-dir", "", "directory holding the stashes (default $CLI_STASH_DIR, then $XDG_DATA_HOME/cli-stash)")
+	rootCmd.PersistentFlags().StringVar(&stashFlag, "stash", "", "named stash to use, or \"all\" (env CLI_STASH_NAME)")
+
+	for _, cmd := range []*cobra.Command{rootCmd, popCmd} {
+		cmd.Flags().String("height", "", "render below the prompt in this many lines or percent of the terminal, e.g. 40%")
+		cmd.Flags().Bool("reverse", false, "show the filter at the bottom, below the list")
+	}
 	rootCmd.AddCommand(popCmd)
+	listCmd.Flags().StringSliceVarP(&listTags, "tag", "t", nil, "only list commands with this tag (repeatable)")
+	listCmd.Flags().StringVarP(&listSort, "sort", "s", string(storage.SortFrecency), "sort order: frecency, count, recent or alpha")
 	rootCmd.AddCommand(listCmd)
+	addCmd.Flags().BoolVarP(&addLast, "last", "l", false, "save the last command of your shell history")
+	addCmd.Flags().StringSliceVarP(&addTags, "tag", "t", nil, "tag the command (repeatable or comma-separated)")
+	addCmd.Flags().StringVarP(&addDesc, "desc", "d", "", "describe the command")
+	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(promoteCmd)
+	rootCmd.AddCommand(editCmd)
+	stashesDeleteCmd.Flags().BoolVarP(&stashesForce, "force", "f", false, "delete even if the stash is not empty")
+	stashesCmd.AddCommand(stashesCreateCmd, stashesDeleteCmd)
+	rootCmd.AddCommand(stashesCmd)
+
+	rootCmd.AddCommand(configCmd)
+
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		loadConfig(cmd)
+	}
 
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 }
@@ -51,20 +185,139 @@ func main() {
 	}
 }
 
+// loadConfig reads the config file and applies environment variables and
+// flags of cmd over it, in increasing order of precedence
+func loadConfig(cmd *cobra.Command) {
+	path, err := config.Path()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	loaded, err := config.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	cfg = loaded
+
+	envDataDir, err := envDir("CLI_STASH_DIR")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.Set("storage.backend", os.Getenv("CLI_STASH_BACKEND"), "env CLI_STASH_BACKEND")
+	cfg.Set("storage.stash", os.Getenv("CLI_STASH_NAME"), "env CLI_STASH_NAME")
+	cfg.Set("storage.data_dir", envDataDir, "env CLI_STASH_DIR")
+	cfg.Set("storage.backend", backendFlag, "flag --backend")
+	cfg.Set("storage.stash", stashFlag, "flag --stash")
+	cfg.Set("storage.data_dir", absPath(dataDirFlag), "flag --data-dir")
+	for setting, flag := range map[string]string{"ui.height": "height", "ui.reverse": "reverse"} {
+		if f := cmd.Flags().Lookup(flag); f != nil && f.Changed {
+			cfg.Set(setting, f.Value.String(), "flag --"+flag)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.Storage.DataDir != "" {
+		storage.SetDir(cfg.Storage.DataDir)
+	}
+	shell.SkipPrefixes = cfg.History.SkipPrefixes
+}
+
+// envDir returns the directory set in the environment variable name. It
+// must be absolute: the variable applies in every working directory, so a
+// relative path would find a different stash in each.
+func envDir(name string) (string, error) {
+	dir := os.Getenv(name)
+	if dir != "" && !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("%s: %q is not an absolute path", name, dir)
+	}
+	return dir, nil
+}
+
+// absPath resolves a directory given on the command line against the
+// current directory, like any path argument. Empty paths stay empty.
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// openStore opens the stash selected by --stash and --backend, merged
+// with the project stash files found above the current directory
+func openStore() (storage.Backend, error) {
+	return openStash(cfg.Storage.Stash)
+}
+
+// openStash opens the named stash like openStore
+func openStash(name string) (storage.Backend, error) {
+	store, err := storage.Open(cfg.Storage.Backend, name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return store, nil
+	}
+	return storage.WithProjectFiles(store, dir), nil
+}
+
+// warnSkipped reports the project stash files store left out when it was
+// last loaded
+func warnSkipped(store storage.Backend) {
+	for _, err := range storage.Skipped(store) {
+		fmt.Fprintf(os.Stderr, "Warning: skipped project stash file: %v\n", err)
+	}
+}
+
 func runPop() {
-	store, err := storage.New()
+	// Only the UI is styled, so only it may query the terminal background
+	ui.ApplyTheme(cfg.UI.Theme, cfg.Colors)
+
+	store, err := openStore()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
 		os.Exit(1)
 	}
 
-	model, err := ui.NewPopModel(store)
+	values, err := storage.OpenValues()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
+		os.Exit(1)
+	}
+
+	place := storage.CurrentPlace()
+	stashes, err := storage.Stashes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
+		os.Exit(1)
+	}
+
+	model, err := ui.NewPopModel(store,
+		ui.WithValues(values),
+		ui.WithPlace(place),
+		ui.WithConfig(cfg),
+		ui.WithStashes(cfg.Storage.Stash, stashes, openStash),
+	)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading commands: %v\n", err)
 		os.Exit(1)
 	}
 
-	p := tea.NewProgram(model)
+	// Take over the screen unless asked to stay below the prompt
+	var opts []tea.ProgramOption
+	if cfg.UI.Height == "" {
+		opts = append(opts, tea.WithAltScreen())
+	}
+	p := tea.NewProgram(model, opts...)
 
 	finalModel, err := p.Run()
 	if err != nil {
@@ -74,8 +327,8 @@ func runPop() {
 
 	if m, ok := finalModel.(ui.PopModel); ok {
 		if selected := m.Selected(); selected != "" {
-			// Increment usage counter
-			store.IncrementUse(selected)
+			// Record the use and where it happened
+			m.Store().IncrementUse(m.SelectedID(), place)
 
 			if err := terminal.InsertInput(selected); err != nil {
 				if clipErr := clipboard.WriteAll(selected); clipErr != nil {
@@ -89,24 +342,432 @@ func runPop() {
 }
 
 func runList() {
-	store, err := storage.New()
+	order, err := storage.ParseSortOrder(listSort)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	store, err := openStore()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
 		os.Exit(1)
 	}
 
-	commands, err := store.List()
+	var commands []storage.Command
+	if len(listTags) > 0 {
+		commands, err = storage.ByTag(store, listTags[0])
+	} else {
+		commands, err = storage.ListSorted(store, order, storage.CurrentPlace())
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading commands: %v\n", err)
 		os.Exit(1)
 	}
+	warnSkipped(store)
+
+	if len(listTags) > 0 {
+		commands = withTags(commands, listTags[1:])
+		if len(commands) == 0 {
+			fmt.Printf("No commands tagged %s.\n", strings.Join(listTags, ", "))
+			return
+		}
+		storage.Sort(commands, order, storage.CurrentPlace())
+	}
 
 	if len(commands) == 0 {
-		fmt.Println("No saved commands. Run 'cli-stash' and press Ctrl+A to add.")
+		fmt.Println("No saved commands. Run 'cli-stash add COMMAND', or 'cli-stash' and press Ctrl+A to add from history.")
 		return
 	}
 
-	for i, cmd := range commands {
-		fmt.Printf("%d. %s\n", i+1, cmd)
+	sourceWidth := 0
+	for _, cmd := range commands {
+		sourceWidth = max(sourceWidth, len(cmd.Stash))
+	}
+
+	for _, cmd := range commands {
+		line := cmd.ID + "  "
+		if sourceWidth > 0 {
+			line += fmt.Sprintf("%-*s  ", sourceWidth, cmd.Stash)
+		}
+		line += cmd.Text
+		if cmd.Origin != "" {
+			line += "  [" + cmd.Origin + "]"
+		}
+		for _, tag := range cmd.Tags {
+			line += " #" + tag
+		}
+		if cmd.Description != "" {
+			line += "  — " + cmd.Description
+		}
+		fmt.Println(line)
+	}
+}
+
+// withTags keeps the commands that carry every one of tags
+func withTags(commands []storage.Command, tags []string) []storage.Command {
+	var result []storage.Command
+	for _, cmd := range commands {
+		matches := true
+		for _, tag := range tags {
+			if !cmd.HasTag(tag) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, cmd)
+		}
+	}
+	return result
+}
+
+func runAdd(args []string) {
+	text, err := addText(args, addLast, os.Stdin, shell.GetLastCommand)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := ui.CheckSyntax(text); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not valid shell syntax: %v\n", err)
+	}
+
+	store, err := openStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
+		os.Exit(1)
+	}
+
+	added, isNew, err := storage.Save(store, storage.Command{
+		Text:        text,
+		Tags:        storage.ParseTags(strings.Join(addTags, ",")),
+		Description: strings.TrimSpace(addDesc),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving command: %v\n", err)
+		os.Exit(1)
+	}
+	if isNew {
+		fmt.Printf("Saved %s  %s\n", added.ID, added.Text)
+	} else {
+		fmt.Printf("Already saved %s  %s\n", added.ID, added.Text)
+	}
+}
+
+// addText returns the command to add, normalized like every saved
+// command: the argument, stdin for "-", or with last the last command of
+// the shell history
+func addText(args []string, last bool, stdin io.Reader, lastCommand func() (string, error)) (string, error) {
+	var text string
+	switch {
+	case last && len(args) > 0:
+		return "", errors.New("give a command or --last, not both")
+	case last:
+		cmd, err := lastCommand()
+		if err != nil {
+			return "", err
+		}
+		if cmd == "" {
+			return "", errors.New("no command found in the shell history")
+		}
+		text = cmd
+	case len(args) == 0:
+		return "", errors.New("give a command, - to read it from stdin, or --last")
+	case args[0] == "-":
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading stdin: %w", err)
+		}
+		text = string(data)
+	default:
+		text = args[0]
+	}
+
+	text = storage.NormalizeText(text)
+	if strings.TrimSpace(text) == "" {
+		return "", storage.ErrEmptyText
+	}
+	return text, nil
+}
+
+func runRemove(refs []string) {
+	store, err := openStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, ref := range refs {
+		cmd, err := storage.Resolve(store, ref)
+		warnSkipped(store)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if err := store.Remove(cmd.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing command: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Removed %s  %s\n", cmd.ID, cmd.Text)
+	}
+}
+
+func runPromote(refs []string) {
+	store, err := openStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
+		os.Exit(1)
+	}
+
+	for _, ref := range refs {
+		cmd, err := storage.Resolve(store, ref)
+		warnSkipped(store)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		promoted, err := storage.Promote(store, cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error promoting %s: %v\n", cmd.ID, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Promoted %s  %s (now %s)\n", cmd.ID, cmd.Text, promoted.ID)
+	}
+}
+
+func runEdit(ref string) {
+	store, err := openStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing storage: %v\n", err)
+		os.Exit(1)
+	}
+	commands, err := store.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading commands: %v\n", err)
+		os.Exit(1)
+	}
+	warnSkipped(store)
+
+	cmd, err := findCommand(commands, ref)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if cmd.Origin != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s comes from %s and is read-only. Run 'cli-stash promote %s' to copy it to your stash first.\n", cmd.ID, cmd.Origin, cmd.ID)
+		os.Exit(1)
+	}
+
+	original := storage.FormatSnippet(cmd)
+	snippet := original
+	for {
+		snippet, err = editSnippet(snippet)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running the editor, nothing saved: %v\n", err)
+			os.Exit(1)
+		}
+		if snippet == original {
+			fmt.Println("No changes.")
+			return
+		}
+
+		edited, err := storage.ParseSnippet(snippet)
+		if err == nil {
+			err = storage.CheckText(commands, cmd.ID, edited.Text)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if ask("Edit again? [Y/n] ", "y") != "y" {
+				fmt.Fprintln(os.Stderr, "Nothing saved.")
+				os.Exit(1)
+			}
+			continue
+		}
+
+		if edited.Text != cmd.Text {
+			if err := ui.CheckSyntax(edited.Text); err != nil {
+				fmt.Fprintf(os.Stderr, "Not valid shell syntax: %v\n", err)
+				switch ask("Edit again, save anyway or quit? [E/s/q] ", "e") {
+				case "e":
+					continue
+				case "s":
+				default:
+					fmt.Fprintln(os.Stderr, "Nothing saved.")
+					os.Exit(1)
+				}
+			}
+		}
+
+		edited.ID = cmd.ID
+		if err := store.Update(edited); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving command: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved %s\n", cmd.ID)
+		return
+	}
+}
+
+// findCommand resolves ref like rm does, or else searches for it. The
+// search must single out one command, unless one is exactly ref.
+func findCommand(commands []storage.Command, ref string) (storage.Command, error) {
+	cmd, err := storage.Find(commands, ref)
+	if !errors.Is(err, storage.ErrNotFound) {
+		return cmd, err
+	}
+
+	matches := ui.Search(commands, ref)
+	for _, cmd := range matches {
+		if cmd.Text == ref {
+			return cmd, nil
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return storage.Command{}, fmt.Errorf("no command matches %q", ref)
+	case 1:
+		return matches[0], nil
+	}
+
+	lines := []string{fmt.Sprintf("%q matches %d commands, pick one by ID:", ref, len(matches))}
+	for i, cmd := range matches {
+		if i == 5 {
+			lines = append(lines, fmt.Sprintf("  … %d more", len(matches)-i))
+			break
+		}
+		lines = append(lines, "  "+cmd.ID+"  "+cmd.Text)
+	}
+	return storage.Command{}, errors.New(strings.Join(lines, "\n"))
+}
+
+// editSnippet lets the user edit snippet in $VISUAL or $EDITOR and returns
+// the result
+func editSnippet(snippet string) (string, error) {
+	file, err := os.CreateTemp("", "cli-stash-*.sh")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(snippet)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := shell.EditCommand(file.Name()).Run(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(file.Name())
+	return string(data), err
+}
+
+// stdin buffers the answers to ask
+var stdin = bufio.NewReader(os.Stdin)
+
+// ask prompts on stderr and returns the lowercased first letter of the
+// answer, or def for an empty answer. Without a terminal to answer on it
+// returns "".
+func ask(prompt, def string) string {
+	fmt.Fprint(os.Stderr, prompt)
+	answer, err := stdin.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return ""
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer == "" {
+		return def
+	}
+	return answer[:1]
+}
+
+func runStashes() {
+	names, err := storage.Stashes()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing stashes: %v\n", err)
+		os.Exit(1)
+	}
+
+	current := cfg.Storage.Stash
+
+	for _, name := range names {
+		marker := "  "
+		if name == current {
+			marker = "* "
+		}
+
+		count := "?"
+		if store, err := storage.OpenReadOnly(cfg.Storage.Backend, name); err == nil {
+			if commands, err := store.Load(); err == nil {
+				count = fmt.Sprint(len(commands))
+			}
+		}
+		fmt.Printf("%s%s (%s commands)\n", marker, name, count)
+	}
+}
+
+func runStashCreate(name string) {
+	if err := storage.CreateStash(cfg.Storage.Backend, name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating stash: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Created stash %s. Use it with --stash %s or CLI_STASH_NAME=%s\n", name, name, name)
+}
+
+func runStashDelete(name string) {
+	if !stashesForce {
+		store, err := storage.OpenReadOnly(cfg.Storage.Backend, name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		commands, err := store.Load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading commands: %v\n", err)
+			os.Exit(1)
+		}
+		if len(commands) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: stash %s has %d commands; use --force to delete it anyway\n", name, len(commands))
+			os.Exit(1)
+		}
+	}
+
+	if err := storage.DeleteStash(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Error deleting stash: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Deleted stash %s\n", name)
+}
+
+func runConfig() {
+	path, err := config.Path()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	status := "not found, using defaults"
+	if _, err := os.Stat(path); err == nil {
+		status = "loaded"
+	}
+	fmt.Printf("# Config file: %s (%s)\n\n", path, status)
+
+	if cfg.Storage.DataDir == "" {
+		// Show where the default lookup ended up
+		if dir, err := storage.Dir(); err == nil {
+			cfg.Storage.DataDir = dir
+		}
+	}
+
+	if err := cfg.Print(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 }
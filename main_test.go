@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/itcaat/cli-stash/internal/storage"
+)
+
+func TestAddText(t *testing.T) {
+	last := func() (string, error) { return "git status", nil }
+
+	tests := []struct {
+		name    string
+		args    []string
+		last    bool
+		stdin   string
+		lastCmd func() (string, error)
+		want    string
+		wantErr string
+	}{
+		{name: "Argument", args: []string{"ls -la "}, want: "ls -la"},
+		{name: "Stdin", args: []string{"-"}, stdin: "ls -la\n", want: "ls -la"},
+		{name: "StdinCRLF", args: []string{"-"}, stdin: "\r\nfor f in *; do\r\n  echo $f\r\ndone\r\n", want: "for f in *; do\n  echo $f\ndone"},
+		{name: "Last", last: true, want: "git status"},
+		{name: "LastAndArgument", args: []string{"ls"}, last: true, wantErr: "not both"},
+		{name: "LastEmpty", last: true, lastCmd: func() (string, error) { return "", nil }, wantErr: "no command found"},
+		{name: "LastError", last: true, lastCmd: func() (string, error) { return "", errors.New("no history") }, wantErr: "no history"},
+		{name: "NoInput", wantErr: "give a command"},
+		{name: "EmptyArgument", args: []string{" "}, wantErr: storage.ErrEmptyText.Error()},
+		{name: "EmptyStdin", args: []string{"-"}, stdin: "\n\n", wantErr: storage.ErrEmptyText.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lastCmd := tt.lastCmd
+			if lastCmd == nil {
+				lastCmd = last
+			}
+			got, err := addText(tt.args, tt.last, strings.NewReader(tt.stdin), lastCmd)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("addText() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("addText() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvDir(t *testing.T) {
+	t.Setenv("CLI_STASH_DIR", "/srv/stash")
+	if dir, err := envDir("CLI_STASH_DIR"); err != nil || dir != "/srv/stash" {
+		t.Errorf("envDir(absolute) = %q, %v", dir, err)
+	}
+
+	t.Setenv("CLI_STASH_DIR", "stash")
+	if _, err := envDir("CLI_STASH_DIR"); err == nil || !strings.Contains(err.Error(), "not an absolute path") {
+		t.Errorf("envDir(relative) error = %v, want not an absolute path", err)
+	}
+
+	t.Setenv("CLI_STASH_DIR", "")
+	if dir, err := envDir("CLI_STASH_DIR"); err != nil || dir != "" {
+		t.Errorf("envDir(unset) = %q, %v", dir, err)
+	}
+}